@@ -11,4 +11,8 @@ var (
 	ErrServerNotExisted = errors.New("server selector: Server has not existed")
 	// ErrUnsupportOp operation must be in Add or Delete
 	ErrUnsupportOp = errors.New("server selector: Unsupport operation, must be one of Add or Delete")
+	// ErrNoHashKey there is no Hasher can be parsed from the context.
+	ErrNoHashKey = errors.New("grpclb: The HashKey is not in the context")
+	// ErrServerDisconnected the owner of the HashKey is disconnected.
+	ErrServerDisconnected = errors.New("grpclb: The owner of the HashKey is disconnected")
 )
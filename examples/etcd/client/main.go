@@ -6,12 +6,13 @@ import (
 	"strings"
 	"time"
 
-	"github.com/coreos/etcd/clientv3"
-	etcdnaming "github.com/coreos/etcd/clientv3/naming"
 	"github.com/teambition/grpclb"
 	"github.com/teambition/grpclb/examples/helloworld"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	etcdresolver "go.etcd.io/etcd/client/v3/naming/resolver"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -26,9 +27,15 @@ func main() {
 	if err != nil {
 		log.Panic(err)
 	}
-	r := &etcdnaming.GRPCResolver{Client: etcdClient}
-	b := grpclb.NewKetamaBalance(r)
-	conn, err := grpc.Dial(*service, grpc.WithBalancer(b), grpc.WithInsecure(), grpc.WithDefaultCallOptions(grpc.FailFast(false)))
+	r, err := etcdresolver.NewBuilder(etcdClient)
+	if err != nil {
+		log.Panic(err)
+	}
+	conn, err := grpc.Dial("etcd:///"+*service,
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"ketama": {}}]}`),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.WaitForReady(true)))
 	if err != nil {
 		log.Panic(err)
 	}
@@ -9,10 +9,10 @@ import (
 	"strings"
 	"syscall"
 
-	"github.com/coreos/etcd/clientv3"
-	etcdnaming "github.com/coreos/etcd/clientv3/naming"
 	"github.com/teambition/grpclb"
 	"github.com/teambition/grpclb/examples/helloworld"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/client/v3/naming/endpoints"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 )
@@ -25,18 +25,32 @@ var (
 )
 
 func etcdAdd(c *clientv3.Client, service, addr string, weight int) error {
-	r := &etcdnaming.GRPCResolver{Client: c}
-	return r.Update(c.Ctx(), service, grpclb.AddServer(addr, grpclb.WeightLvl(weight)))
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return err
+	}
+	// the metadata is encoded as a string, so the balancer reads it after the round trip.
+	meta := grpclb.ServerMeta{Weight: grpclb.WeightLvl(weight)}
+	return em.AddEndpoint(c.Ctx(), service+"/"+addr, endpoints.Endpoint{Addr: addr, Metadata: meta.String()})
 }
 
-func etcdDelete(c *clientv3.Client, service, addr string) error {
-	r := &etcdnaming.GRPCResolver{Client: c}
-	return r.Update(c.Ctx(), service, grpclb.DeleteServer(addr))
+// etcdDrain updates the state of the server to draining, so it takes no new RPCs
+// while the in-flight ones finish.
+func etcdDrain(c *clientv3.Client, service, addr string, weight int) error {
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return err
+	}
+	meta := grpclb.ServerMeta{Weight: grpclb.WeightLvl(weight), State: grpclb.Draining}
+	return em.AddEndpoint(c.Ctx(), service+"/"+addr, endpoints.Endpoint{Addr: addr, Metadata: meta.String()})
 }
 
-func etcdLeaseAdd(c *clientv3.Client, lid clientv3.LeaseID, service, addr string, weight int) error {
-	r := &etcdnaming.GRPCResolver{Client: c}
-	return r.Update(c.Ctx(), service, grpclb.AddServer(addr, grpclb.WeightLvl(weight)), clientv3.WithLease(lid))
+func etcdDelete(c *clientv3.Client, service, addr string) error {
+	em, err := endpoints.NewManager(c, service)
+	if err != nil {
+		return err
+	}
+	return em.DeleteEndpoint(c.Ctx(), service+"/"+addr)
 }
 
 func main() {
@@ -64,6 +78,8 @@ func main() {
 	}()
 
 	<-signals
+	etcdDrain(etcdClient, *service, *addr, *weight)
+	s.GracefulStop()
 	etcdDelete(etcdClient, *service, *addr)
 }
 
@@ -0,0 +1,27 @@
+module github.com/teambition/grpclb/examples
+
+go 1.17
+
+require (
+	github.com/golang/protobuf v1.5.3
+	github.com/teambition/grpclb v0.0.0
+	go.etcd.io/etcd/client/v3 v3.5.9
+	golang.org/x/net v0.11.0
+	google.golang.org/grpc v1.54.0
+	gopkg.in/mgo.v2 v2.0.0-20190816093944-a6b53ec6cb22
+)
+
+require (
+	github.com/cespare/xxhash v1.1.0 // indirect
+	github.com/gogo/protobuf v1.3.2 // indirect
+	github.com/spaolacci/murmur3 v1.1.0 // indirect
+	github.com/tevino/abool v1.2.0 // indirect
+	go.etcd.io/etcd/api/v3 v3.5.9 // indirect
+	go.etcd.io/etcd/client/pkg/v3 v3.5.9 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+)
+
+replace github.com/teambition/grpclb => ../
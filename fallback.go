@@ -0,0 +1,59 @@
+package grpclb
+
+import (
+	"math/rand"
+	"sync/atomic"
+)
+
+// FallbackPolicy the policy to pick a server for the RPC without HashKey in the context.
+type FallbackPolicy int
+
+const (
+	// NoFallback fail the RPC with ErrNoHashKey of codes.InvalidArgument.
+	NoFallback FallbackPolicy = iota
+	// RoundRobin pick the servers in turn.
+	RoundRobin
+	// Random pick a server randomly.
+	Random
+	// LeastConns pick the server with the least in-flight requests.
+	LeastConns
+)
+
+// fallback picks an accepted server by the policy, the servers of zero weight are excluded.
+func (p *pool) fallback(policy FallbackPolicy, accept func(s *server) bool) (*server, error) {
+	weighted := func(s *server) bool {
+		return !p.zero[s.addr.Addr] && accept(s)
+	}
+	n := len(p.list)
+	if n == 0 {
+		return nil, ErrNoServer
+	}
+
+	var start int
+	switch policy {
+	case RoundRobin:
+		start = int(atomic.AddUint64(&p.next, 1) % uint64(n))
+	case Random:
+		start = rand.Intn(n)
+	case LeastConns:
+		var picked *server
+		for _, s := range p.list {
+			if weighted(s) && (picked == nil || atomic.LoadUint64(&s.currConns) < atomic.LoadUint64(&picked.currConns)) {
+				picked = s
+			}
+		}
+		if picked == nil {
+			return nil, ErrNoServer
+		}
+		return picked, nil
+	default:
+		return nil, ErrNoHashKey
+	}
+
+	for i := 0; i < n; i++ {
+		if s := p.list[(start+i)%n]; weighted(s) {
+			return s, nil
+		}
+	}
+	return nil, ErrNoServer
+}
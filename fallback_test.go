@@ -0,0 +1,65 @@
+package grpclb
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_ketama_fallback(t *testing.T) {
+	acceptAll := func(s *server) bool { return true }
+	tests := []struct {
+		name    string
+		k       *ketama
+		p       FallbackPolicy
+		wantErr error
+	}{
+		{"no fallback", newTestKetama("127.0.0.1:8080"), NoFallback, ErrNoHashKey},
+		{"round robin", newTestKetama("127.0.0.1:8080", "127.0.0.1:8081"), RoundRobin, nil},
+		{"random", newTestKetama("127.0.0.1:8080", "127.0.0.1:8081"), Random, nil},
+		{"least conns", newTestKetama("127.0.0.1:8080", "127.0.0.1:8081"), LeastConns, nil},
+		{"empty ring", newTestKetama(), RoundRobin, ErrNoServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.k.fallback(tt.p, acceptAll); err != tt.wantErr {
+				t.Errorf("ketama.fallback() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ketama_fallback_spread(t *testing.T) {
+	for _, p := range []FallbackPolicy{RoundRobin, LeastConns} {
+		k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082")
+		for i := 0; i < 9; i++ {
+			s, _ := k.fallback(p, func(s *server) bool { return true })
+			k.acquire(s)
+		}
+		for _, s := range k.list {
+			if s.currConns != 3 {
+				t.Errorf("ketama.fallback(%v) picked server(%s) %v times, want 3", p, s.addr.Addr, s.currConns)
+			}
+		}
+	}
+}
+
+func Test_ketama_fallback_zeroWeight(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081")
+	k.add(newServer(resolver.Address{Addr: "127.0.0.1:8082", Metadata: ServerMeta{Weight: ZeroWeight}}))
+	k.update(k.servers["127.0.0.1:8081"], 0)
+	k.rebuild()
+	for _, p := range []FallbackPolicy{RoundRobin, Random, LeastConns} {
+		for i := 0; i < 10; i++ {
+			if s, err := k.fallback(p, func(s *server) bool { return true }); err != nil || s.addr.Addr != "127.0.0.1:8080" {
+				t.Fatalf("ketama.fallback(%v) = %v, %v, picked the server of zero weight", p, s.addr.Addr, err)
+			}
+		}
+	}
+	// the servers of zero weight are not in the average of the loads, so the only
+	// server of weight is not capped by them.
+	k.acquire(k.servers["127.0.0.1:8080"])
+	if !k.underLoad(1)(k.servers["127.0.0.1:8080"]) {
+		t.Errorf("ketama.underLoad(1) capped the server by the servers of zero weight")
+	}
+}
@@ -0,0 +1,19 @@
+module github.com/teambition/grpclb
+
+go 1.17
+
+require (
+	github.com/cespare/xxhash v1.1.0
+	github.com/spaolacci/murmur3 v1.1.0
+	github.com/tevino/abool v1.2.0
+	golang.org/x/net v0.11.0
+	google.golang.org/grpc v1.54.0
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/sys v0.9.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
+	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
+	google.golang.org/protobuf v1.30.0 // indirect
+)
@@ -1,13 +1,15 @@
 package grpclb
 
 import (
-	"hash/fnv"
 	"strconv"
 
 	"golang.org/x/net/context"
 )
 
-var _ Hasher = new(strOrNum)
+var (
+	_ Hasher   = new(strOrNum)
+	_ Hasher64 = new(strOrNum64)
+)
 
 // HasherFromContext parse Hasher from context.
 type HasherFromContext func(context.Context) (Hasher, bool)
@@ -18,6 +20,15 @@ type Hasher interface {
 	Hash32() uint32
 }
 
+// Hasher64 the Hasher with 64-bit hash, the ring looks up the key by Hash64
+// automatically when the Hasher implements it, which is recommended for the
+// ring with thousands of servers.
+type Hasher64 interface {
+	Hasher
+	// Hash64 uint64 result
+	Hash64() uint64
+}
+
 type strOrNum struct {
 	hash32 uint32
 }
@@ -28,18 +39,27 @@ func (s *strOrNum) Hash32() uint32 {
 }
 
 func newStrOrNum(value interface{}) (*strOrNum, bool) {
-	var data []byte
+	return newStrOrNumWith(value, FNV32a)
+}
+
+// newStrOrNumWith hash the value with the RingHasher.
+func newStrOrNumWith(value interface{}, rh RingHasher) (*strOrNum, bool) {
+	data, ok := strOrNumBytes(value)
+	if !ok {
+		return nil, false
+	}
+	return &strOrNum{hash32: rh.Sum32(data)}, true
+}
+
+func strOrNumBytes(value interface{}) ([]byte, bool) {
 	switch v := value.(type) {
 	case string:
-		data = []byte(v)
+		return []byte(v), true
 	case uint32:
-		data = []byte(strconv.FormatUint(uint64(v), 10))
+		return []byte(strconv.FormatUint(uint64(v), 10)), true
 	default:
 		return nil, false
 	}
-	h := fnv.New32a()
-	h.Write(data)
-	return &strOrNum{hash32: h.Sum32()}, true
 }
 
 type contextKey struct{}
@@ -51,6 +71,37 @@ func strOrNumFromContext(ctx context.Context) (Hasher, bool) {
 	return newStrOrNum(ctx.Value(strOrNumKey))
 }
 
+type strOrNum64 struct {
+	strOrNum
+	hash64 uint64
+}
+
+// Hash64 Hasher64 implement with the RingHasher64.
+func (s *strOrNum64) Hash64() uint64 {
+	return s.hash64
+}
+
+// newHasherWith hash the value with the RingHasher, the result is a Hasher64 if
+// the RingHasher is a RingHasher64.
+func newHasherWith(value interface{}, rh RingHasher) (Hasher, bool) {
+	s, ok := newStrOrNumWith(value, rh)
+	if !ok {
+		return nil, false
+	}
+	if rh64, ok := rh.(RingHasher64); ok {
+		data, _ := strOrNumBytes(value)
+		return &strOrNum64{strOrNum: *s, hash64: rh64.Sum64(data)}, true
+	}
+	return s, true
+}
+
+// strOrNumFromContextWith get Hasher from Context by key and hash it with the RingHasher.
+func strOrNumFromContextWith(rh RingHasher) HasherFromContext {
+	return func(ctx context.Context) (Hasher, bool) {
+		return newHasherWith(ctx.Value(strOrNumKey), rh)
+	}
+}
+
 // StrOrNumToContext set string or number into Context.
 func StrOrNumToContext(ctx context.Context, val interface{}) context.Context {
 	return context.WithValue(ctx, strOrNumKey, val)
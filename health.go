@@ -0,0 +1,218 @@
+package grpclb
+
+import (
+	"sync"
+	"time"
+
+	"github.com/tevino/abool"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	// DefaultHealthCheckInterval the default interval of the health checks.
+	DefaultHealthCheckInterval = 10 * time.Second
+	// DefaultUnhealthyThreshold the default consecutive failures to mark a server unhealthy.
+	DefaultUnhealthyThreshold = 3
+	// DefaultHealthyThreshold the default consecutive successes to mark a server healthy again.
+	DefaultHealthyThreshold = 2
+)
+
+// HealthCheck configures the active health checking by grpc.health.v1.Health/Check.
+// The unhealthy servers are kept out of the picks until they recover, the thresholds
+// keep a flapping server from moving its keys back and forth.
+type HealthCheck struct {
+	// Service the service name to check, empty for the overall health of the server.
+	Service string
+	// Interval between the checks, DefaultHealthCheckInterval by default.
+	Interval time.Duration
+	// Timeout of each check, Interval by default.
+	Timeout time.Duration
+	// UnhealthyThreshold the consecutive failures to mark a server unhealthy,
+	// DefaultUnhealthyThreshold by default.
+	UnhealthyThreshold int
+	// HealthyThreshold the consecutive successes to mark an unhealthy server healthy,
+	// DefaultHealthyThreshold by default.
+	HealthyThreshold int
+	// DialOptions dial the servers for the checks, the insecure transport credentials by
+	// default, so the checks of the servers serving TLS always fail without them.
+	DialOptions []grpc.DialOption
+}
+
+// healthChecker checks the servers by their addresses on the interval, so the states
+// survive the rebuilds of the pickers.
+type healthChecker struct {
+	hc     HealthCheck
+	logger Logger
+	conns  map[string]*grpc.ClientConn // only accessed by the checks.
+	done   chan struct{}
+
+	mu     sync.Mutex
+	states map[string]*healthState
+}
+
+// healthState the health of a server.
+type healthState struct {
+	unhealthy abool.AtomicBool
+
+	// only accessed by the checks.
+	failures  int
+	successes int
+}
+
+func newHealthChecker(hc HealthCheck, logger Logger) *healthChecker {
+	if hc.Interval <= 0 {
+		hc.Interval = DefaultHealthCheckInterval
+	}
+	if hc.Timeout <= 0 {
+		hc.Timeout = hc.Interval
+	}
+	if hc.UnhealthyThreshold <= 0 {
+		hc.UnhealthyThreshold = DefaultUnhealthyThreshold
+	}
+	if hc.HealthyThreshold <= 0 {
+		hc.HealthyThreshold = DefaultHealthyThreshold
+	}
+	if len(hc.DialOptions) == 0 {
+		hc.DialOptions = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &healthChecker{
+		hc:     hc,
+		logger: logger,
+		conns:  map[string]*grpc.ClientConn{},
+		states: map[string]*healthState{},
+		done:   make(chan struct{}),
+	}
+}
+
+func (c *healthChecker) run() {
+	ticker := time.NewTicker(c.hc.Interval)
+	defer ticker.Stop()
+	defer c.closeConns(nil)
+
+	for {
+		c.checkAll()
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *healthChecker) stop() {
+	close(c.done)
+}
+
+// stateOf the health of the server, it is created at the first time and checked
+// from the next round.
+func (c *healthChecker) stateOf(addr string) *healthState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	st, ok := c.states[addr]
+	if !ok {
+		st = &healthState{}
+		c.states[addr] = st
+	}
+	return st
+}
+
+// retain stops checking the servers not in addrs.
+func (c *healthChecker) retain(addrs map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for addr := range c.states {
+		if !addrs[addr] {
+			delete(c.states, addr)
+		}
+	}
+}
+
+// checkAll checks the servers concurrently, then applies the results.
+func (c *healthChecker) checkAll() {
+	c.mu.Lock()
+	states := make(map[string]*healthState, len(c.states))
+	for addr, st := range c.states {
+		states[addr] = st
+	}
+	c.mu.Unlock()
+
+	current := make(map[string]bool, len(states))
+	results := make(map[string]bool, len(states))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for addr := range states {
+		current[addr] = true
+		conn, err := c.conn(addr)
+		if err != nil {
+			c.logger.Warningf("grpclb: Failed to dial server(%s) for health check due to error(%v).\n", addr, err)
+			continue
+		}
+		wg.Add(1)
+		go func(addr string, conn *grpc.ClientConn) {
+			defer wg.Done()
+			healthy := c.check(conn)
+			mu.Lock()
+			results[addr] = healthy
+			mu.Unlock()
+		}(addr, conn)
+	}
+	wg.Wait()
+
+	for addr, st := range states {
+		c.apply(addr, st, results[addr])
+	}
+	c.closeConns(current)
+}
+
+func (c *healthChecker) check(conn *grpc.ClientConn) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), c.hc.Timeout)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{Service: c.hc.Service})
+	return err == nil && resp.Status == healthpb.HealthCheckResponse_SERVING
+}
+
+// apply marks the server by the thresholds of the consecutive results.
+func (c *healthChecker) apply(addr string, st *healthState, healthy bool) {
+	if healthy {
+		st.failures = 0
+		st.successes++
+		if st.unhealthy.IsSet() && st.successes >= c.hc.HealthyThreshold {
+			st.unhealthy.UnSet()
+			c.logger.Infof("grpclb: The server(%s) is healthy again.\n", addr)
+		}
+		return
+	}
+	st.successes = 0
+	st.failures++
+	if !st.unhealthy.IsSet() && st.failures >= c.hc.UnhealthyThreshold {
+		st.unhealthy.Set()
+		c.logger.Warningf("grpclb: The server(%s) is unhealthy after %d failed health checks.\n", addr, st.failures)
+	}
+}
+
+func (c *healthChecker) conn(addr string) (*grpc.ClientConn, error) {
+	if conn, ok := c.conns[addr]; ok {
+		return conn, nil
+	}
+	conn, err := grpc.Dial(addr, c.hc.DialOptions...)
+	if err != nil {
+		return nil, err
+	}
+	c.conns[addr] = conn
+	return conn, nil
+}
+
+// closeConns closes the connections to the servers not in current.
+func (c *healthChecker) closeConns(current map[string]bool) {
+	for addr, conn := range c.conns {
+		if !current[addr] {
+			conn.Close()
+			delete(c.conns, addr)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package grpclb
+
+import (
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_healthChecker_checkAll(t *testing.T) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	hs := health.NewServer()
+	gs := grpc.NewServer()
+	healthpb.RegisterHealthServer(gs, hs)
+	go gs.Serve(lis)
+	defer gs.Stop()
+
+	c := newHealthChecker(HealthCheck{Service: "test", UnhealthyThreshold: 2, HealthyThreshold: 2}, grpcLogger{})
+	defer c.closeConns(nil)
+	s := newServer(resolver.Address{Addr: lis.Addr().String()})
+	s.health = c.stateOf(s.addr.Addr)
+
+	tests := []struct {
+		name   string
+		status healthpb.HealthCheckResponse_ServingStatus
+		want   bool
+	}{
+		{"serving", healthpb.HealthCheckResponse_SERVING, true},
+		{"first failure", healthpb.HealthCheckResponse_NOT_SERVING, true},
+		{"second failure", healthpb.HealthCheckResponse_NOT_SERVING, false},
+		{"first success", healthpb.HealthCheckResponse_SERVING, false},
+		{"second success", healthpb.HealthCheckResponse_SERVING, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hs.SetServingStatus("test", tt.status)
+			c.checkAll()
+			if got := s.active(); got != tt.want {
+				t.Errorf("healthChecker.checkAll() active = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
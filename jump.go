@@ -0,0 +1,114 @@
+package grpclb
+
+import "sort"
+
+// jumpHash the servers are picked by the bucket of the jump consistent hash, the buckets
+// are the shards indexed by the ShardIndex of the servers.
+type jumpHash struct {
+	*pool
+	// shards the servers by their ShardIndex, the missing shards and the servers of zero
+	// weight are the nil holes, then the servers without ShardIndex.
+	shards []*server
+}
+
+func newJumpHash(p *pool) selector {
+	return &jumpHash{pool: p}
+}
+
+func (j *jumpHash) add(s *server) {
+	if j.register(s) {
+		j.place()
+	}
+}
+
+func (j *jumpHash) delete(addr string) {
+	if _, ok := j.unregister(addr); ok {
+		j.place()
+	}
+}
+
+// update the jump hash has no weight, but the server of zero weight is a hole.
+func (j *jumpHash) update(s *server, w WeightLvl) {
+	j.setWeight(s, w)
+	j.place()
+}
+
+// place lays out the shards, the number of the buckets is the max ShardIndex + 1, so the
+// keys of the other shards are not moved when a shard is missing or of zero weight.
+func (j *jumpHash) place() {
+	var size int
+	for _, s := range j.list {
+		if s.meta.Sharded && int(s.meta.Shard) >= size {
+			size = int(s.meta.Shard) + 1
+		}
+	}
+	shards := make([]*server, size)
+	var rest []*server
+	for _, s := range j.list {
+		if s.weight <= 0 {
+			continue
+		}
+		i := s.meta.Shard
+		switch {
+		case !s.meta.Sharded || i < 0:
+			rest = append(rest, s)
+		case shards[i] != nil:
+			j.opts.logger.Warningf("grpclb: The servers(%s, %s) are of the same shard(%d).\n", shards[i].addr.Addr, s.addr.Addr, i)
+			rest = append(rest, s)
+		default:
+			shards[i] = s
+		}
+	}
+	sort.Slice(rest, func(a, b int) bool {
+		return shardLess(rest[a], rest[b])
+	})
+	j.shards = append(shards, rest...)
+}
+
+// walk starts from the bucket of the key and goes to the next shards, the holes are skipped.
+func (j *jumpHash) walk(h Hasher, fn func(s *server) bool) {
+	n := len(j.shards)
+	if n == 0 {
+		return
+	}
+	b := jump(jumpKey(h), n)
+	for i := 0; i < n; i++ {
+		if s := j.shards[(b+i)%n]; s != nil && !fn(s) {
+			return
+		}
+	}
+}
+
+func (j *jumpHash) snapshot(p *pool) selector {
+	return &jumpHash{pool: p, shards: append([]*server(nil), j.shards...)}
+}
+
+// shardLess the servers with ShardIndex are ordered before the others, the metadata
+// is parsed when the servers are added and updated by modify.
+func shardLess(a, b *server) bool {
+	if a.meta.Sharded != b.meta.Sharded {
+		return a.meta.Sharded
+	}
+	if a.meta.Shard != b.meta.Shard {
+		return a.meta.Shard < b.meta.Shard
+	}
+	return a.addr.Addr < b.addr.Addr
+}
+
+func jumpKey(h Hasher) uint64 {
+	if h64, ok := h.(Hasher64); ok {
+		return h64.Hash64()
+	}
+	return uint64(h.Hash32())
+}
+
+// jump returns the bucket of the key in [0, buckets).
+func jump(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
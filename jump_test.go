@@ -0,0 +1,110 @@
+package grpclb
+
+import (
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_jump(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		prev := jump(key*2654435761, 1)
+		if prev != 0 {
+			t.Fatalf("jump(%v, 1) = %v, want 0", key, prev)
+		}
+		for n := 2; n <= 32; n++ {
+			b := jump(key*2654435761, n)
+			if b < 0 || b >= n {
+				t.Fatalf("jump(%v, %v) = %v, out of range", key, n, b)
+			}
+			if b != prev && b != n-1 {
+				t.Fatalf("jump(%v, %v) moved from %v to %v, want to %v", key, n, prev, b, n-1)
+			}
+			prev = b
+		}
+	}
+}
+
+func Test_jumpHash_add(t *testing.T) {
+	tests := []struct {
+		name    string
+		servers []resolver.Address
+		want    []string
+	}{
+		{
+			"ordered by shard index",
+			[]resolver.Address{{Addr: "127.0.0.1:8082", Metadata: ShardIndex(0)}, {Addr: "127.0.0.1:8080", Metadata: "shard=2"}, {Addr: "127.0.0.1:8081", Metadata: ShardIndex(1)}},
+			[]string{"127.0.0.1:8082", "127.0.0.1:8081", "127.0.0.1:8080"},
+		},
+		{
+			"without shard index",
+			[]resolver.Address{{Addr: "127.0.0.1:8081"}, {Addr: "127.0.0.1:8082", Metadata: ShardIndex(0)}, {Addr: "127.0.0.1:8080"}},
+			[]string{"127.0.0.1:8082", "127.0.0.1:8080", "127.0.0.1:8081"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j := newJumpHash(newPool(newOptions())).(*jumpHash)
+			for _, addr := range tt.servers {
+				j.add(newServer(addr))
+			}
+			for i, s := range j.shards {
+				if s.addr.Addr != tt.want[i] {
+					t.Errorf("jumpHash.shards[%d] = %v, want %v", i, s.addr.Addr, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_jumpHash_walk(t *testing.T) {
+	j := newJumpHash(newPool(newOptions())).(*jumpHash)
+	for i, addr := range []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082"} {
+		j.add(newServer(resolver.Address{Addr: addr, Metadata: ShardIndex(i)}))
+	}
+	h, _ := newStrOrNum("key")
+	var walked []*server
+	j.walk(h, func(s *server) bool {
+		walked = append(walked, s)
+		return true
+	})
+	if len(walked) != 3 {
+		t.Fatalf("jumpHash.walk() walked %v servers, want 3", len(walked))
+	}
+	if want := j.shards[jump(uint64(h.Hash32()), 3)]; walked[0] != want {
+		t.Errorf("jumpHash.walk() starts from %v, want %v", walked[0].addr.Addr, want.addr.Addr)
+	}
+
+	j.delete("127.0.0.1:8081")
+	if _, err := lookup(j, h); err != nil {
+		t.Errorf("lookup() error = %v", err)
+	}
+}
+
+func Test_jumpHash_holes(t *testing.T) {
+	j := newJumpHash(newPool(newOptions())).(*jumpHash)
+	for i, addr := range []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082", "127.0.0.1:8083"} {
+		j.add(newServer(resolver.Address{Addr: addr, Metadata: ShardIndex(i)}))
+	}
+	owners := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _ := lookup(j, h)
+		owners[i] = s.addr.Addr
+	}
+
+	// a shard of zero weight and a missing one are the holes, the keys of the others stay.
+	j.update(j.servers["127.0.0.1:8081"], 0)
+	j.delete("127.0.0.1:8082")
+	if len(j.shards) != 4 {
+		t.Errorf("jumpHash.shards = %v, want 4 buckets", len(j.shards))
+	}
+	for i := 0; i < 1000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _ := lookup(j, h)
+		if owner := owners[i]; owner != "127.0.0.1:8081" && owner != "127.0.0.1:8082" && s.addr.Addr != owner {
+			t.Fatalf("lookup(%v) = %v, moved from %v", i, s.addr.Addr, owner)
+		}
+	}
+}
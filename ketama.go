@@ -0,0 +1,314 @@
+package grpclb
+
+import (
+	"math"
+	"sort"
+	"strconv"
+)
+
+// ketama the consistent hash ring.
+type ketama struct {
+	*pool
+	replica       map[uint64]*server
+	sortedHashSet []uint64
+	// owners the owners of the points in sortedHashSet, walk reads them instead of replica.
+	owners []*server
+	// collided the servers lost the points to the owners in replica.
+	collided map[uint64][]*server
+	// points the virtual nodes of each server, so delete doesn't scan the ring.
+	points map[*server][]uint64
+	// added the new points and changed the points deleted or taken over since the
+	// last rebuild, they are merged into sortedHashSet by rebuild.
+	added   []uint64
+	changed map[uint64]struct{}
+	dirty   bool
+}
+
+func newKetama(p *pool) selector {
+	return &ketama{
+		pool:          p,
+		replica:       map[uint64]*server{},
+		sortedHashSet: []uint64{},
+		collided:      map[uint64][]*server{},
+		points:        map[*server][]uint64{},
+		changed:       map[uint64]struct{}{},
+	}
+}
+
+func (k *ketama) add(s *server) {
+	if !k.register(s) {
+		return
+	}
+	k.dirty = true
+	// the points of the whole ring are placed by rebuild.
+	if k.opts.libketama || k.opts.ringSize > 0 {
+		return
+	}
+	k.resize(s, k.replicaCount(s.weight, 0))
+}
+
+func (k *ketama) update(s *server, w WeightLvl) {
+	if k.servers[s.addr.Addr] != s {
+		return
+	}
+	k.setWeight(s, w)
+	k.dirty = true
+	if k.opts.libketama || k.opts.ringSize > 0 {
+		return
+	}
+	k.resize(s, k.replicaCount(w, 0))
+}
+
+// resize adds or removes the virtual nodes at the tail of the server, the others stay.
+func (k *ketama) resize(s *server, to int) {
+	points := k.points[s]
+	from := len(points)
+	if to > from {
+		for _, h := range k.virtualNodes(s, from, to) {
+			k.addPoint(h, s)
+			points = append(points, h)
+		}
+	} else {
+		for _, h := range points[to:] {
+			k.delPoint(h, s)
+		}
+		points = points[:to:to]
+	}
+	k.points[s] = points
+}
+
+// replicaCount the number of the virtual nodes of the weight, the server of zero weight
+// has none. With WithRingSize, the count is the share of the weight in totalWeight.
+func (k *ketama) replicaCount(w, totalWeight WeightLvl) int {
+	if w <= 0 {
+		return 0
+	}
+	var n int
+	if k.opts.ringSize > 0 {
+		n = int(math.Round(float64(k.opts.ringSize) * float64(w/totalWeight)))
+	} else {
+		n = k.opts.replicas(w)
+	}
+	if n <= 0 {
+		return 1
+	}
+	return n
+}
+
+// the strides between the seeds of the virtual nodes of a server, they don't depend
+// on the number of the virtual nodes, so the i-th virtual node stays when the weight
+// of the server changes.
+const (
+	pointStride32 = math.MaxUint32 / uint64(Level1)
+	pointStride64 = math.MaxUint64 / uint64(Level1)
+)
+
+// virtualNodes the points of the server on the ring, from the from-th to the to-th.
+func (k *ketama) virtualNodes(s *server, from, to int) []uint64 {
+	points := make([]uint64, 0, to-from)
+	if rh, ok := k.opts.ringHasher.(RingHasher64); ok {
+		serverHash := rh.Sum64([]byte(s.addr.Addr))
+		for i := from + 1; i <= to; i++ {
+			points = append(points, rh.Sum64([]byte(strconv.FormatUint(serverHash+uint64(i)*pointStride64, 10))))
+		}
+	} else {
+		rh := k.opts.ringHasher
+		serverHash := uint64(rh.Sum32([]byte(s.addr.Addr)))
+		for i := from + 1; i <= to; i++ {
+			points = append(points, point32(rh.Sum32([]byte(strconv.FormatUint(serverHash+uint64(i)*pointStride32, 10)))))
+		}
+	}
+	return points
+}
+
+// rebuild merges the points added since the last rebuild into the sorted ring and
+// drops the deleted ones in one pass, so a batch of M points costs O(N + M log M)
+// instead of a full sort per server. The ring is snapshotted right after, so the
+// work is done under the lock and the returned build is a no-op.
+func (k *ketama) rebuild() func() {
+	if k.dirty {
+		if k.opts.libketama {
+			k.rebuildLibketama()
+		} else {
+			if k.opts.ringSize > 0 {
+				k.normalize()
+			}
+			k.merge()
+		}
+		k.dirty = false
+	}
+	return func() {}
+}
+
+// normalize resizes the servers to their shares of the ring size, the points are
+// added or removed at the tails, so only the delta of the keys moves.
+func (k *ketama) normalize() {
+	var totalWeight WeightLvl
+	for _, s := range k.list {
+		totalWeight += s.weight
+	}
+	for _, s := range k.list {
+		k.resize(s, k.replicaCount(s.weight, totalWeight))
+	}
+}
+
+func (k *ketama) merge() {
+	sort.Slice(k.added, func(i int, j int) bool {
+		return k.added[i] < k.added[j]
+	})
+
+	// the new slices are allocated, so the snapshots keep the old ones.
+	points := make([]uint64, 0, len(k.replica))
+	owners := make([]*server, 0, len(k.replica))
+	i, added := 0, k.added
+	for i < len(k.sortedHashSet) || len(added) > 0 {
+		var h uint64
+		var owner *server
+		if len(added) == 0 || i < len(k.sortedHashSet) && k.sortedHashSet[i] < added[0] {
+			h, owner = k.sortedHashSet[i], k.owners[i]
+			if _, ok := k.changed[h]; ok {
+				owner = k.replica[h]
+			}
+			i++
+		} else {
+			h, added = added[0], added[1:]
+			owner = k.replica[h]
+		}
+		if owner != nil {
+			points = append(points, h)
+			owners = append(owners, owner)
+		}
+	}
+	k.sortedHashSet, k.owners = points, owners
+	k.added = k.added[:0]
+	k.changed = map[uint64]struct{}{}
+}
+
+// addPoint places a virtual node of the server at h. When h is owned by another
+// server, the one with the smaller address wins and the other is kept in collided,
+// so the layout of the ring doesn't depend on the order the servers are added.
+func (k *ketama) addPoint(h uint64, s *server) {
+	owner, ok := k.replica[h]
+	if !ok {
+		k.replica[h] = s
+		if _, ok := k.changed[h]; !ok {
+			k.added = append(k.added, h)
+		}
+		// or it is in sortedHashSet or added already.
+		return
+	}
+	if owner == s {
+		return
+	}
+
+	k.opts.logger.Warningf("grpclb: The virtual nodes of server(%s) and server(%s) collided at %d.\n", owner.addr.Addr, s.addr.Addr, h)
+	k.opts.metrics.collided(owner.addr.Addr, s.addr.Addr)
+	if s.addr.Addr < owner.addr.Addr {
+		k.replica[h] = s
+		k.changed[h] = struct{}{}
+		s = owner
+	}
+	k.collided[h] = append(k.collided[h], s)
+}
+
+// delPoint removes the virtual node of the server at h, the collided server with
+// the smallest address takes over the point.
+func (k *ketama) delPoint(h uint64, s *server) {
+	losers := k.collided[h]
+	if k.replica[h] != s {
+		for i, v := range losers {
+			if v == s {
+				losers = append(losers[:i], losers[i+1:]...)
+				break
+			}
+		}
+	} else if len(losers) == 0 {
+		// the point is dropped from sortedHashSet by the next rebuild.
+		delete(k.replica, h)
+		k.changed[h] = struct{}{}
+		return
+	} else {
+		min := 0
+		for i, v := range losers {
+			if v.addr.Addr < losers[min].addr.Addr {
+				min = i
+			}
+		}
+		k.replica[h] = losers[min]
+		k.changed[h] = struct{}{}
+		losers = append(losers[:min], losers[min+1:]...)
+	}
+
+	if len(losers) == 0 {
+		delete(k.collided, h)
+	} else {
+		k.collided[h] = losers
+	}
+}
+
+// point32 places the 32-bit hash at the high 32 bits of the 64-bit ring,
+// so the 32-bit keys are owned by the same servers as on a 32-bit ring.
+func point32(h uint32) uint64 {
+	return uint64(h) << 32
+}
+
+// ringKey the position of the hash key on the ring.
+func ringKey(h Hasher) uint64 {
+	if h64, ok := h.(Hasher64); ok {
+		return h64.Hash64()
+	}
+	return point32(h.Hash32())
+}
+
+func (k *ketama) delete(addr string) {
+	s, ok := k.unregister(addr)
+	if !ok {
+		return
+	}
+	k.dirty = true
+	if k.opts.libketama {
+		return
+	}
+	for _, h := range k.points[s] {
+		k.delPoint(h, s)
+	}
+	delete(k.points, s)
+}
+
+// walk calls fn on the distinct servers clockwise from the hash key on the ring,
+// until fn returns false.
+func (k *ketama) walk(h Hasher, fn func(s *server) bool) {
+	length := len(k.sortedHashSet)
+	if length == 0 {
+		return
+	}
+
+	key := ringKey(h)
+	idx := sort.Search(length, func(i int) bool {
+		return k.sortedHashSet[i] >= key
+	})
+
+	var visited map[*server]struct{}
+	for i := 0; i < length; i++ {
+		s := k.owners[(idx+i)%length]
+		if visited != nil {
+			if _, ok := visited[s]; ok {
+				continue
+			}
+		}
+		if !fn(s) {
+			return
+		}
+		if len(visited) == len(k.servers)-1 {
+			return
+		}
+		if visited == nil {
+			visited = make(map[*server]struct{}, len(k.servers))
+		}
+		visited[s] = struct{}{}
+	}
+}
+
+func (k *ketama) snapshot(p *pool) selector {
+	return &ketama{pool: p, sortedHashSet: k.sortedHashSet, owners: k.owners}
+}
@@ -0,0 +1,362 @@
+package grpclb
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/resolver"
+)
+
+func newTestKetama(addrs ...string) *ketama {
+	k := newKetama(newPool(newOptions())).(*ketama)
+	for _, addr := range addrs {
+		k.add(newServer(resolver.Address{Addr: addr, Metadata: float64(Level1)}))
+	}
+	k.rebuild()
+	return k
+}
+
+func Test_ketama_add(t *testing.T) {
+	tests := []struct {
+		name   string
+		addrs  []string
+		points int
+	}{
+		{"one server", []string{"127.0.0.1:8080"}, int(Level1)},
+		{"two servers", []string{"127.0.0.1:8080", "127.0.0.1:8081"}, 2 * int(Level1)},
+		{"existed server", []string{"127.0.0.1:8080", "127.0.0.1:8080"}, int(Level1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKetama(tt.addrs...)
+			if got := len(k.sortedHashSet); got != tt.points {
+				t.Errorf("ketama.add() points = %v, want %v", got, tt.points)
+			}
+		})
+	}
+}
+
+func Test_ketama_delete(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082")
+	owners := map[string]string{}
+	for _, key := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		h, _ := newStrOrNum(key)
+		s, _ := lookup(k, h)
+		owners[key] = s.addr.Addr
+	}
+
+	k.delete("127.0.0.1:8081")
+	k.rebuild()
+	if got := len(k.sortedHashSet); got != 2*int(Level1) {
+		t.Errorf("ketama.delete() points = %v, want %v", got, 2*int(Level1))
+	}
+	for key, owner := range owners {
+		h, _ := newStrOrNum(key)
+		s, _ := lookup(k, h)
+		if owner != "127.0.0.1:8081" && s.addr.Addr != owner {
+			t.Errorf("lookup(ketama, %s) = %v, want %v", key, s.addr.Addr, owner)
+		}
+		if s.addr.Addr == "127.0.0.1:8081" {
+			t.Errorf("lookup(ketama, %s) returns the deleted server", key)
+		}
+	}
+}
+
+func Test_ketama_lookup(t *testing.T) {
+	h, _ := newStrOrNum("key")
+	tests := []struct {
+		name    string
+		k       *ketama
+		wantErr error
+	}{
+		{"empty ring", newTestKetama(), ErrNoServer},
+		{"one server", newTestKetama("127.0.0.1:8080"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := lookup(tt.k, h); err != tt.wantErr {
+				t.Errorf("lookup() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_ketama_underLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		c    float64
+	}{
+		{"c = 1", 1},
+		{"c = 1.25", 1.25},
+		{"c = 2", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082")
+			h, _ := newStrOrNum("hot key")
+			for i := 1; i <= 30; i++ {
+				s, _, err := search(k, h, k.underLoad(tt.c))
+				if err != nil {
+					t.Fatalf("search() error = %v", err)
+				}
+				limit := uint64(math.Ceil(tt.c * float64(i) / 3))
+				if s.currConns >= limit {
+					t.Errorf("search() picked a full server, load %v, limit %v", s.currConns, limit)
+				}
+				k.acquire(s)
+			}
+		})
+	}
+}
+
+func Test_ketama_search(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082")
+	h, _ := newStrOrNum("key")
+	owner, _ := lookup(k, h)
+
+	tests := []struct {
+		name     string
+		accept   func(s *server) bool
+		wantHops int
+		wantErr  error
+	}{
+		{"accept owner", func(s *server) bool { return true }, 0, nil},
+		{"skip owner", func(s *server) bool { return s != owner }, 1, nil},
+		{"accept none", func(s *server) bool { return false }, 3, ErrNoServer},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, hops, err := search(k, h, tt.accept)
+			if err != tt.wantErr {
+				t.Errorf("search() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hops != tt.wantHops {
+				t.Errorf("search() hops = %v, want %v", hops, tt.wantHops)
+			}
+		})
+	}
+}
+
+func Test_ringKey(t *testing.T) {
+	tests := []struct {
+		name string
+		h    Hasher
+		want uint64
+	}{
+		{"32-bit hasher", &strOrNum{hash32: 123}, 123 << 32},
+		{"64-bit hasher", &strOrNum64{strOrNum{hash32: 123}, 456}, 456},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ringKey(tt.h); got != tt.want {
+				t.Errorf("ringKey() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_ketama_add64(t *testing.T) {
+	k := newKetama(newPool(newOptions(WithRingHasher(XXHash)))).(*ketama)
+	for i := 0; i < 100; i++ {
+		k.add(newServer(resolver.Address{Addr: "10.0.0." + strconv.Itoa(i) + ":8080", Metadata: float64(Level5)}))
+	}
+	k.rebuild()
+	if len(k.replica) != len(k.sortedHashSet) {
+		t.Errorf("ketama.add() %v points collided", len(k.sortedHashSet)-len(k.replica))
+	}
+
+	ctx := StrOrNumToContext(context.Background(), "key")
+	h, _ := k.opts.f(ctx)
+	if _, ok := h.(Hasher64); !ok {
+		t.Fatalf("options.f() = %T, want a Hasher64", h)
+	}
+	if _, err := lookup(k, h); err != nil {
+		t.Errorf("lookup() error = %v", err)
+	}
+}
+
+// collidingHasher hashes onto 16 points only.
+type collidingHasher struct{}
+
+func (collidingHasher) Sum32(data []byte) uint32 {
+	return FNV32a.Sum32(data) % 16
+}
+
+func Test_ketama_addPoint(t *testing.T) {
+	addrs := []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082"}
+	layout := func(k *ketama) map[uint64]string {
+		m := map[uint64]string{}
+		for h, s := range k.replica {
+			m[h] = s.addr.Addr
+		}
+		return m
+	}
+
+	var collisions int
+	opts := newOptions(WithRingHasher(collidingHasher{}), WithMetrics(Metrics{
+		Collided: func(addr1, addr2 string) { collisions++ },
+	}))
+	k1, k2 := newKetama(newPool(opts)).(*ketama), newKetama(newPool(opts)).(*ketama)
+	for i := range addrs {
+		k1.add(newServer(resolver.Address{Addr: addrs[i], Metadata: float64(Level1)}))
+		k2.add(newServer(resolver.Address{Addr: addrs[len(addrs)-1-i], Metadata: float64(Level1)}))
+	}
+	k1.rebuild()
+	k2.rebuild()
+	if collisions == 0 {
+		t.Fatalf("ketama.addPoint() no collision")
+	}
+	if !reflect.DeepEqual(layout(k1), layout(k2)) {
+		t.Errorf("ketama.addPoint() layout depends on the order of adding")
+	}
+	if len(k1.sortedHashSet) != len(k1.replica) {
+		t.Errorf("ketama.addPoint() points = %v, want %v", len(k1.sortedHashSet), len(k1.replica))
+	}
+
+	k1.delete(addrs[0])
+	k1.rebuild()
+	k3 := newKetama(newPool(opts)).(*ketama)
+	for _, addr := range addrs[1:] {
+		k3.add(newServer(resolver.Address{Addr: addr, Metadata: float64(Level1)}))
+	}
+	k3.rebuild()
+	if !reflect.DeepEqual(layout(k1), layout(k3)) {
+		t.Errorf("ketama.delPoint() layout = %v, want %v", layout(k1), layout(k3))
+	}
+	if len(k1.sortedHashSet) != len(k1.replica) {
+		t.Errorf("ketama.delPoint() points = %v, want %v", len(k1.sortedHashSet), len(k1.replica))
+	}
+}
+
+func Test_ketama_rebuild(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081")
+	// a batch deletes a server, adds it back and adds a new one.
+	k.delete("127.0.0.1:8080")
+	k.add(newServer(resolver.Address{Addr: "127.0.0.1:8080", Metadata: float64(Level1)}))
+	k.add(newServer(resolver.Address{Addr: "127.0.0.1:8082", Metadata: float64(Level1)}))
+	k.delete("127.0.0.1:8081")
+	k.rebuild()
+
+	want := newTestKetama("127.0.0.1:8080", "127.0.0.1:8082")
+	if !reflect.DeepEqual(k.sortedHashSet, want.sortedHashSet) {
+		t.Errorf("ketama.rebuild() points = %v, want %v", len(k.sortedHashSet), len(want.sortedHashSet))
+	}
+	for i, h := range k.sortedHashSet {
+		if k.owners[i] != k.replica[h] {
+			t.Fatalf("ketama.rebuild() owner of point %v = %v, want %v", h, k.owners[i].addr.Addr, k.replica[h].addr.Addr)
+		}
+		if k.replica[h].addr.Addr != want.replica[h].addr.Addr {
+			t.Fatalf("ketama.rebuild() point %v is owned by %v, want %v", h, k.replica[h].addr.Addr, want.replica[h].addr.Addr)
+		}
+	}
+}
+
+func newBenchKetama(n int) *ketama {
+	k := newKetama(newPool(newOptions())).(*ketama)
+	for i := 0; i < n; i++ {
+		k.add(newServer(resolver.Address{Addr: "10." + strconv.Itoa(i/256) + "." + strconv.Itoa(i%256) + ".1:8080", Metadata: float64(Level1)}))
+	}
+	k.rebuild()
+	return k
+}
+
+func BenchmarkKetama_build10k(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		newBenchKetama(10000)
+	}
+}
+
+func BenchmarkKetama_update10k(b *testing.B) {
+	k := newBenchKetama(10000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		addr := k.list[i%len(k.list)].addr
+		k.delete(addr.Addr)
+		k.add(newServer(addr))
+		k.rebuild()
+	}
+}
+
+func BenchmarkKetama_lookup10k(b *testing.B) {
+	k := newBenchKetama(10000)
+	h, _ := newStrOrNum("key")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		lookup(k, h)
+	}
+}
+
+func Test_ketama_update(t *testing.T) {
+	addrs := []string{"127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082"}
+	k := newTestKetama(addrs...)
+	owners := map[int]*server{}
+	for i := 0; i < 1000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		owners[i], _ = lookup(k, h)
+	}
+
+	s := k.servers["127.0.0.1:8081"]
+	k.update(s, Level2)
+	k.rebuild()
+	for i, owner := range owners {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		if got, _ := lookup(k, h); got != owner && got != s {
+			t.Fatalf("ketama.update() moved key %v from %v to %v", i, owner.addr.Addr, got.addr.Addr)
+		}
+	}
+
+	want := newKetama(newPool(newOptions())).(*ketama)
+	for _, addr := range addrs {
+		w := Level1
+		if addr == s.addr.Addr {
+			w = Level2
+		}
+		want.add(newServer(resolver.Address{Addr: addr, Metadata: w}))
+	}
+	want.rebuild()
+	if !reflect.DeepEqual(k.sortedHashSet, want.sortedHashSet) {
+		t.Errorf("ketama.update() points = %v, want %v", len(k.sortedHashSet), len(want.sortedHashSet))
+	}
+
+	k.update(s, Level1)
+	k.rebuild()
+	for i, owner := range owners {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		if got, _ := lookup(k, h); got != owner {
+			t.Fatalf("ketama.update() key %v is owned by %v, want %v", i, got.addr.Addr, owner.addr.Addr)
+		}
+	}
+}
+
+func Test_ketama_normalize(t *testing.T) {
+	k := newKetama(newPool(newOptions(WithRingSize(1000)))).(*ketama)
+	weights := map[string]WeightLvl{"127.0.0.1:8080": 1, "127.0.0.1:8081": 2, "127.0.0.1:8082": 0.5, "127.0.0.1:8083": 0}
+	for addr, w := range weights {
+		k.add(newServer(resolver.Address{Addr: addr, Metadata: w}))
+	}
+	k.rebuild()
+	for addr, w := range weights {
+		if got, want := len(k.points[k.servers[addr]]), int(math.Round(1000*float64(w)/3.5)); got != want {
+			t.Errorf("ketama.normalize() server(%s) points = %v, want %v", addr, got, want)
+		}
+	}
+
+	// the points of the others shrink at the tails when a server is added.
+	before := map[uint64]*server{}
+	for h, s := range k.replica {
+		before[h] = s
+	}
+	k.add(newServer(resolver.Address{Addr: "127.0.0.1:8084", Metadata: WeightLvl(3.5)}))
+	k.rebuild()
+	for h, s := range k.replica {
+		if owner, ok := before[h]; ok && owner != s {
+			t.Fatalf("ketama.normalize() point %v moved from %v to %v", h, owner.addr.Addr, s.addr.Addr)
+		}
+	}
+	if got := len(k.sortedHashSet); got < 990 || got > 1010 {
+		t.Errorf("ketama.normalize() points = %v, want about 1000", got)
+	}
+}
@@ -0,0 +1,48 @@
+package grpclb
+
+import (
+	"crypto/md5"
+	"math"
+	"strconv"
+)
+
+// libketamaPoints the points of a server generated as libketama does, see
+// ketama_create_continuum in https://github.com/RJ/ketama/blob/master/libketama/ketama.c.
+func libketamaPoints(addr string, w, totalWeight WeightLvl, servers int) []uint32 {
+	if w <= 0 {
+		return nil
+	}
+	// the float precision follows libketama to get the same number of points.
+	pct := float32(w) / float32(totalWeight)
+	ks := int(math.Floor(float64(float32(float64(pct) * 40.0 * float64(float32(servers))))))
+
+	points := make([]uint32, 0, ks*4)
+	for i := 0; i < ks; i++ {
+		d := md5.Sum([]byte(addr + "-" + strconv.Itoa(i)))
+		for h := 0; h < 4; h++ {
+			points = append(points, uint32(d[3+h*4])<<24|uint32(d[2+h*4])<<16|uint32(d[1+h*4])<<8|uint32(d[h*4]))
+		}
+	}
+	return points
+}
+
+// rebuildLibketama the number of points of each server depends on the total weight,
+// so the whole ring is rebuilt once per batch of changes.
+func (k *ketama) rebuildLibketama() {
+	var totalWeight WeightLvl
+	for _, s := range k.list {
+		totalWeight += s.weight
+	}
+
+	k.replica = make(map[uint64]*server, len(k.sortedHashSet))
+	k.collided = map[uint64][]*server{}
+	k.sortedHashSet, k.owners = nil, nil
+	k.added = k.added[:0]
+	k.changed = map[uint64]struct{}{}
+	for _, s := range k.list {
+		for _, h := range libketamaPoints(s.addr.Addr, s.weight, totalWeight, len(k.list)) {
+			k.addPoint(point32(h), s)
+		}
+	}
+	k.merge()
+}
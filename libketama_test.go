@@ -0,0 +1,63 @@
+package grpclb
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_libketamaPoints(t *testing.T) {
+	type args struct {
+		w           WeightLvl
+		totalWeight WeightLvl
+		servers     int
+	}
+	tests := []struct {
+		name string
+		args args
+		want int
+	}{
+		{"equal weights", args{Level1, 3 * Level1, 3}, 160},
+		{"double weight", args{Level2, 4 * Level1, 3}, 240},
+		{"half weight", args{Level1, 4 * Level1, 3}, 120},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(libketamaPoints("127.0.0.1:11211", tt.args.w, tt.args.totalWeight, tt.args.servers)); got != tt.want {
+				t.Errorf("libketamaPoints() points = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	d := md5.Sum([]byte("127.0.0.1:11211-0"))
+	points := libketamaPoints("127.0.0.1:11211", Level1, Level1, 1)
+	for h := 0; h < 4; h++ {
+		if want := binary.LittleEndian.Uint32(d[h*4:]); points[h] != want {
+			t.Errorf("libketamaPoints()[%d] = %v, want %v", h, points[h], want)
+		}
+	}
+}
+
+func Test_ketama_rebuildLibketama(t *testing.T) {
+	k := newKetama(newPool(newOptions(WithLibketama()))).(*ketama)
+	for _, addr := range []string{"127.0.0.1:11211", "127.0.0.1:11212", "127.0.0.1:11213"} {
+		k.add(newServer(resolver.Address{Addr: addr, Metadata: float64(Level1)}))
+	}
+	k.rebuild()
+	if got := len(k.sortedHashSet); got != 3*160 {
+		t.Errorf("ketama.add() points = %v, want %v", got, 3*160)
+	}
+
+	k.delete("127.0.0.1:11212")
+	k.rebuild()
+	if got := len(k.sortedHashSet); got != 2*160 {
+		t.Errorf("ketama.delete() points = %v, want %v", got, 2*160)
+	}
+	for _, s := range k.replica {
+		if s.addr.Addr == "127.0.0.1:11212" {
+			t.Fatalf("ketama.delete() the deleted server is still on the ring")
+		}
+	}
+}
@@ -0,0 +1,25 @@
+package grpclb
+
+import "google.golang.org/grpc/grpclog"
+
+// Logger the logger of the balancers, grpclog.LoggerV2 implements it.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// grpcLogger writes to the grpclog.
+type grpcLogger struct{}
+
+func (grpcLogger) Infof(format string, args ...interface{}) {
+	grpclog.Infof(format, args...)
+}
+
+func (grpcLogger) Warningf(format string, args ...interface{}) {
+	grpclog.Warningf(format, args...)
+}
+
+func (grpcLogger) Errorf(format string, args ...interface{}) {
+	grpclog.Errorf(format, args...)
+}
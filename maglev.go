@@ -0,0 +1,197 @@
+package grpclb
+
+import (
+	"math/big"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultMaglevTableSize the default size of the Maglev lookup table.
+const DefaultMaglevTableSize = 65537
+
+type maglevNode struct {
+	s      *server
+	offset uint64
+	skip   uint64
+	weight float64
+}
+
+type maglev struct {
+	*pool
+	nodes []maglevNode
+	table *maglevTable
+}
+
+// maglevTable the lookup table is installed by the builds off the lock, it is shared
+// by the snapshots, so they pick up the table built after them.
+type maglevTable struct {
+	atomic.Value // []*server
+
+	mu        sync.Mutex
+	gen       uint64
+	installed uint64
+}
+
+func newMaglev(p *pool) selector {
+	return &maglev{pool: p, table: &maglevTable{}}
+}
+
+func (m *maglev) add(s *server) {
+	if !m.register(s) {
+		return
+	}
+	size := m.opts.maglevTableSize
+	var h uint64
+	if rh, ok := m.opts.ringHasher.(RingHasher64); ok {
+		h = rh.Sum64([]byte(s.addr.Addr))
+	} else {
+		h = mix64(uint64(m.opts.ringHasher.Sum32([]byte(s.addr.Addr))))
+	}
+	m.nodes = append(m.nodes, maglevNode{
+		s:      s,
+		offset: h % size,
+		skip:   mix64(h)%(size-1) + 1,
+		weight: float64(s.weight),
+	})
+}
+
+func (m *maglev) delete(addr string) {
+	s, ok := m.unregister(addr)
+	if !ok {
+		return
+	}
+	for i, n := range m.nodes {
+		if n.s == s {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (m *maglev) update(s *server, w WeightLvl) {
+	m.setWeight(s, w)
+	for i := range m.nodes {
+		if m.nodes[i].s == s {
+			m.nodes[i].weight = float64(w)
+			return
+		}
+	}
+}
+
+// rebuild the first table is built at once, so the picks never see an empty table.
+func (m *maglev) rebuild() func() {
+	nodes := make([]maglevNode, len(m.nodes))
+	copy(nodes, m.nodes)
+
+	t := m.table
+	t.mu.Lock()
+	t.gen++
+	gen := t.gen
+	t.mu.Unlock()
+
+	build := func() {
+		table := populateMaglev(nodes, m.opts.maglevTableSize)
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		// drop the table built from an older snapshot.
+		if gen > t.installed {
+			t.installed = gen
+			t.Store(table)
+		}
+	}
+	if m.table.Load() == nil {
+		build()
+		return func() {}
+	}
+	return build
+}
+
+// walk starts from the entry of the key and goes to the next entries, the servers
+// deleted after the table was built are skipped.
+func (m *maglev) walk(h Hasher, fn func(s *server) bool) {
+	table, _ := m.table.Load().([]*server)
+	size := len(table)
+	if size == 0 || len(m.servers) == 0 {
+		return
+	}
+
+	idx := int(ringKey(h) % uint64(size))
+	var visited map[*server]struct{}
+	for i := 0; i < size; i++ {
+		s := table[(idx+i)%size]
+		if s == nil || m.servers[s.addr.Addr] != s {
+			continue
+		}
+		if visited != nil {
+			if _, ok := visited[s]; ok {
+				continue
+			}
+		}
+		if !fn(s) {
+			return
+		}
+		if len(visited) == len(m.servers)-1 {
+			return
+		}
+		if visited == nil {
+			visited = make(map[*server]struct{}, len(m.servers))
+		}
+		visited[s] = struct{}{}
+	}
+}
+
+func (m *maglev) snapshot(p *pool) selector {
+	// the servers deleted after the table was built are skipped by p.servers.
+	return &maglev{pool: p, table: m.table}
+}
+
+// populateMaglev fills the table by the permutations of the nodes, a node takes its
+// turn only when its entries are fewer than its share of the weights so far.
+func populateMaglev(nodes []maglevNode, size uint64) []*server {
+	table := make([]*server, size)
+	if len(nodes) == 0 {
+		return table
+	}
+
+	var maxWeight float64
+	for _, n := range nodes {
+		if n.weight > maxWeight {
+			maxWeight = n.weight
+		}
+	}
+	if maxWeight == 0 {
+		// all servers are of zero weight.
+		return table
+	}
+	next := make([]uint64, len(nodes))
+	counts := make([]float64, len(nodes))
+	var filled uint64
+	for round := 1.0; ; round++ {
+		for i, n := range nodes {
+			if counts[i] >= round*n.weight/maxWeight {
+				continue
+			}
+			c := (n.offset + next[i]*n.skip) % size
+			for table[c] != nil {
+				next[i]++
+				c = (n.offset + next[i]*n.skip) % size
+			}
+			table[c] = n.s
+			next[i]++
+			counts[i]++
+			if filled++; filled == size {
+				return table
+			}
+		}
+	}
+}
+
+// nextPrime the smallest prime not less than n.
+func nextPrime(n uint64) uint64 {
+	if n <= 2 {
+		return 2
+	}
+	for ; !new(big.Int).SetUint64(n).ProbablyPrime(0); n++ {
+	}
+	return n
+}
@@ -0,0 +1,73 @@
+package grpclb
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_nextPrime(t *testing.T) {
+	tests := []struct {
+		n    uint64
+		want uint64
+	}{
+		{0, 2},
+		{7, 7},
+		{1000, 1009},
+		{65536, 65537},
+	}
+	for _, tt := range tests {
+		if got := nextPrime(tt.n); got != tt.want {
+			t.Errorf("nextPrime(%v) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func Test_populateMaglev(t *testing.T) {
+	m := newTestSelector(newMaglev, newPool(newOptions(WithMaglevTableSize(1000))), Level1, Level2, Level1).(*maglev)
+	table := m.table.Load().([]*server)
+	if len(table) != 1009 {
+		t.Fatalf("populateMaglev() size = %v, want 1009", len(table))
+	}
+	counts := map[string]int{}
+	for _, s := range table {
+		if s == nil {
+			t.Fatalf("populateMaglev() left an empty entry")
+		}
+		counts[s.addr.Addr]++
+	}
+	// the entries are in proportion to the weights 1:2:1.
+	if c := counts["127.0.0.1:8081"]; c < 500 || c > 510 {
+		t.Errorf("populateMaglev() entries of the Level2 server = %v, want about 504", c)
+	}
+}
+
+func Test_maglev_delete(t *testing.T) {
+	m := newTestSelector(newMaglev, newPool(newOptions(WithMaglevTableSize(1000))), Level1, Level1, Level1, Level1).(*maglev)
+	h, _ := newStrOrNum("key")
+	owner, _ := lookup(m, h)
+
+	m.delete(owner.addr.Addr)
+	// the stale table skips the deleted server before the rebuild.
+	s, err := lookup(m, h)
+	if err != nil || s == owner {
+		t.Fatalf("lookup() = %v, %v before rebuild", s, err)
+	}
+	m.rebuild()()
+	if s, err = lookup(m, h); err != nil || s == owner {
+		t.Errorf("lookup() = %v, %v after rebuild", s, err)
+	}
+
+	moved := 0
+	before := m.table.Load().([]*server)
+	m.add(newServer(resolver.Address{Addr: "127.0.0.1:9090", Metadata: float64(Level1)}))
+	m.rebuild()()
+	for i, s := range m.table.Load().([]*server) {
+		if s != before[i] {
+			moved++
+		}
+	}
+	if moved > len(before)/2 {
+		t.Errorf("maglev.rebuild() moved %v of %v entries", moved, len(before))
+	}
+}
@@ -0,0 +1,147 @@
+package grpclb
+
+import (
+	"encoding/json"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ServerMeta the structured metadata of the server. It is comparable, so it can be
+// the Metadata of resolver.Address which is compared by grpc, and it is encoded as a
+// string in JSON, so it is still comparable after the addresses are stored in etcd
+// and decoded into interface{}.
+type ServerMeta struct {
+	// Weight the zero weight is unset, that is Level1, set ZeroWeight to exclude the server.
+	Weight  WeightLvl
+	Zone    string
+	Version string
+	// Tags the comma separated tags, see NewTags.
+	Tags  string
+	State ServerState
+	// Shard the index of the server for the jump hash, it is set only if Sharded.
+	Shard   ShardIndex
+	Sharded bool
+}
+
+// NewTags joins the tags for ServerMeta.Tags in order, so the same tags are always equal.
+func NewTags(tags ...string) string {
+	ts := append([]string(nil), tags...)
+	sort.Strings(ts)
+	return strings.Join(ts, ",")
+}
+
+// HasTag reports whether the server has the tag.
+func (m ServerMeta) HasTag(tag string) bool {
+	for _, t := range strings.Split(m.Tags, ",") {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// String encodes the metadata as a URL query, such as "weight=200&zone=az1".
+func (m ServerMeta) String() string {
+	v := url.Values{}
+	if m.Weight != 0 {
+		v.Set("weight", strconv.FormatFloat(float64(m.Weight), 'g', -1, 64))
+	}
+	if m.Zone != "" {
+		v.Set("zone", m.Zone)
+	}
+	if m.Version != "" {
+		v.Set("version", m.Version)
+	}
+	if m.Tags != "" {
+		v.Set("tags", m.Tags)
+	}
+	if m.State != "" {
+		v.Set("state", string(m.State))
+	}
+	if m.Sharded {
+		v.Set("shard", strconv.Itoa(int(m.Shard)))
+	}
+	return v.Encode()
+}
+
+// ParseServerMeta decodes the metadata encoded by ServerMeta.String,
+// a bare state such as "draining" is accepted too.
+func ParseServerMeta(s string) (ServerMeta, error) {
+	if s != "" && !strings.Contains(s, "=") {
+		return ServerMeta{State: ServerState(s)}, nil
+	}
+	v, err := url.ParseQuery(s)
+	if err != nil {
+		return ServerMeta{}, err
+	}
+	m := ServerMeta{
+		Zone:    v.Get("zone"),
+		Version: v.Get("version"),
+		Tags:    v.Get("tags"),
+		State:   ServerState(v.Get("state")),
+	}
+	if w := v.Get("weight"); w != "" {
+		n, err := strconv.ParseFloat(w, 64)
+		if err != nil {
+			return ServerMeta{}, err
+		}
+		m.Weight = WeightLvl(n)
+	}
+	if i := v.Get("shard"); i != "" {
+		n, err := strconv.Atoi(i)
+		if err != nil {
+			return ServerMeta{}, err
+		}
+		m.Shard, m.Sharded = ShardIndex(n), true
+	}
+	return m, nil
+}
+
+// MarshalJSON encodes the metadata as a JSON string.
+func (m ServerMeta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON decodes the metadata from a JSON string.
+func (m *ServerMeta) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	meta, err := ParseServerMeta(s)
+	if err != nil {
+		return err
+	}
+	*m = meta
+	return nil
+}
+
+// metaFromMetadata the Metadata of resolver.Address, which is a ServerMeta, a WeightLvl,
+// a ServerState or a ShardIndex, or decoded from JSON.
+func metaFromMetadata(meta interface{}) ServerMeta {
+	switch m := meta.(type) {
+	case ServerMeta:
+		return m
+	case *ServerMeta:
+		if m != nil {
+			return *m
+		}
+	case WeightLvl:
+		return ServerMeta{Weight: m}
+	case ServerState:
+		return ServerMeta{State: m}
+	case ShardIndex:
+		return ServerMeta{Shard: m, Sharded: true}
+	case float64:
+		// the WeightLvl decoded from JSON.
+		return ServerMeta{Weight: WeightLvl(m)}
+	case string:
+		// the ServerMeta or ServerState decoded from JSON.
+		if sm, err := ParseServerMeta(m); err == nil {
+			return sm
+		}
+	}
+	return ServerMeta{}
+}
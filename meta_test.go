@@ -0,0 +1,76 @@
+package grpclb
+
+import (
+	"encoding/json"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func TestServerMeta_json(t *testing.T) {
+	meta := ServerMeta{Weight: Level2, Zone: "az1", Version: "v1.2.0", Tags: NewTags("gpu", "canary"), State: Draining}
+	// the update of the server is stored in etcd as JSON.
+	type update struct {
+		Addr     string
+		Metadata interface{}
+	}
+	data, err := json.Marshal(update{Addr: "127.0.0.1:8080", Metadata: meta})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	var u update
+	if err := json.Unmarshal(data, &u); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	// the decoded metadata is still usable as a map key.
+	_ = map[resolver.Address]bool{{Addr: u.Addr, Metadata: u.Metadata}: true}
+	if got := metaFromMetadata(u.Metadata); got != meta {
+		t.Errorf("metaFromMetadata() = %+v, want %+v", got, meta)
+	}
+	// the shard index is not taken as the weight after the round trip.
+	data, err = json.Marshal(update{Addr: "127.0.0.1:8080", Metadata: ServerMeta{Shard: 0, Sharded: true}})
+	if err != nil {
+		t.Fatalf("json.Marshal() error = %v", err)
+	}
+	if err := json.Unmarshal(data, &u); err != nil {
+		t.Fatalf("json.Unmarshal() error = %v", err)
+	}
+	if m := metaFromMetadata(u.Metadata); m.Shard != 0 || !m.Sharded {
+		t.Errorf("metaFromMetadata() shard = %v, %v, want 0, true", m.Shard, m.Sharded)
+	}
+	if w := weightFromMetadata(u.Metadata); w != Level1 {
+		t.Errorf("weightFromMetadata() = %v, want %v", w, Level1)
+	}
+	if !meta.HasTag("gpu") || meta.HasTag("gp") {
+		t.Errorf("ServerMeta.HasTag() tags = %v", meta.Tags)
+	}
+}
+
+func Test_metaFromMetadata(t *testing.T) {
+	tests := []struct {
+		name string
+		meta interface{}
+		want ServerMeta
+	}{
+		{"ServerMeta", ServerMeta{Weight: Level3, Zone: "az1"}, ServerMeta{Weight: Level3, Zone: "az1"}},
+		{"*ServerMeta", &ServerMeta{Zone: "az1"}, ServerMeta{Zone: "az1"}},
+		{"WeightLvl", Level2, ServerMeta{Weight: Level2}},
+		{"WeightLvl from JSON", float64(Level2), ServerMeta{Weight: Level2}},
+		{"ServerState", Draining, ServerMeta{State: Draining}},
+		{"ServerState from JSON", "draining", ServerMeta{State: Draining}},
+		{"ServerMeta from JSON", "weight=300&zone=az1", ServerMeta{Weight: Level3, Zone: "az1"}},
+		{"ShardIndex", ShardIndex(0), ServerMeta{Shard: 0, Sharded: true}},
+		{"ServerMeta of shard from JSON", "shard=0", ServerMeta{Shard: 0, Sharded: true}},
+		{"ServerMeta of zero weight from JSON", "weight=-1", ServerMeta{Weight: ZeroWeight}},
+		{"invalid weight", "weight=x", ServerMeta{}},
+		{"invalid shard", "shard=x", ServerMeta{}},
+		{"nil", nil, ServerMeta{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := metaFromMetadata(tt.meta); got != tt.want {
+				t.Errorf("metaFromMetadata() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
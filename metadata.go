@@ -1,39 +1,33 @@
 package grpclb
 
 import (
+	"time"
+
 	"github.com/tevino/abool"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/naming"
+	"google.golang.org/grpc/resolver"
 )
 
 type server struct {
-	addr      grpc.Address
+	addr      resolver.Address
 	connected abool.AtomicBool
+	draining  abool.AtomicBool
 	currConns uint64
+	meta      ServerMeta // parsed when the server is added, and updated by the writers.
+	// weight the current weight, it is changed in place by the selector under the lock.
+	weight WeightLvl
+	// started the time the slow start of the server begins, zero if it is not slow started.
+	started time.Time
+	// health the health of the server, nil if the health checking is disabled.
+	health *healthState
+	// outlier the errors of the server, nil if the outlier detection is disabled.
+	outlier *outlierStats
+	// zoneLoad the loads of the zone of the server, nil if the servers are not zoned.
+	zoneLoad *counters
 }
 
-// AddServer new an add Update event for server registry
-func AddServer(addr string, weight WeightLvl) naming.Update {
-	return naming.Update{
-		Op:   naming.Add,
-		Addr: addr,
-		// because of the grpc-go lib user Address as map's key,
-		// so the Metadata can't be a interface{} type,
-		// if do then thrown an error about unhashabled key type.
-		Metadata: weight,
-	}
-}
-
-// DeleteServer new a delete Update event for server registry
-func DeleteServer(addr string) naming.Update {
-	return naming.Update{
-		Op:   naming.Delete,
-		Addr: addr,
-	}
-}
-
-// WeightLvl the weight level of endpoint
-type WeightLvl int
+// WeightLvl the weight of endpoint, it can be any non-negative number, fractional
+// or zero to exclude the server, the levels are the common ones.
+type WeightLvl float64
 
 const (
 	Level1 WeightLvl = (iota + 1) * 100
@@ -48,13 +42,52 @@ const (
 	Level10
 )
 
+// ZeroWeight the weight of ServerMeta to exclude the server, whose zero Weight is unset.
+const ZeroWeight WeightLvl = -1
+
+// weightFromMetadata the weight of the server is Level1 by default, the zero WeightLvl
+// excludes the server, and the negative one is treated as zero.
 func weightFromMetadata(meta interface{}) WeightLvl {
 	var w WeightLvl
-	if m, ok := meta.(float64); ok {
+	switch m := meta.(type) {
+	case WeightLvl:
+		w = m
+	case float64:
+		// decoded from JSON.
 		w = WeightLvl(m)
+	default:
+		// the zero weight of ServerMeta is unset.
+		if w = metaFromMetadata(meta).Weight; w == 0 {
+			return Level1
+		}
 	}
-	if w <= Level1 {
-		w = Level1
+	if !(w > 0) {
+		// negative or NaN.
+		return 0
 	}
 	return w
 }
+
+// ShardIndex the index of the server in the ordered backend list, it is set by
+// ServerMeta.Shard, or as the Metadata itself in process.
+type ShardIndex int
+
+// ServerState the state of the server in its metadata.
+type ServerState string
+
+// Draining the server takes no new RPCs.
+const Draining ServerState = "draining"
+
+// newServer new a server with the metadata parsed.
+func newServer(addr resolver.Address) *server {
+	s := &server{addr: addr, meta: metaFromMetadata(addr.Metadata), weight: weightFromMetadata(addr.Metadata)}
+	s.draining.SetTo(s.meta.State == Draining)
+	return s
+}
+
+// active the server takes new RPCs.
+func (s *server) active() bool {
+	return !s.draining.IsSet() &&
+		(s.health == nil || !s.health.unhealthy.IsSet()) &&
+		(s.outlier == nil || !s.outlier.ejected.IsSet())
+}
@@ -3,12 +3,12 @@ package grpclb
 import (
 	"testing"
 
-	"google.golang.org/grpc/naming"
+	"google.golang.org/grpc/resolver"
 )
 
 func Test_weightFromUpdate(t *testing.T) {
 	type args struct {
-		u *naming.Update
+		addr resolver.Address
 	}
 	tests := []struct {
 		name string
@@ -16,13 +16,20 @@ func Test_weightFromUpdate(t *testing.T) {
 		want WeightLvl
 	}{
 		// TODO: Add test cases.
-		{"get weigth lvl1 from metadata", args{&naming.Update{Addr: "", Metadata: float64(Level1)}}, Level1},
-		{"get weigth lvl10 from metadata", args{&naming.Update{Addr: "", Metadata: float64(Level10)}}, Level10},
+		{"get weigth lvl1 from metadata", args{resolver.Address{Addr: "", Metadata: float64(Level1)}}, Level1},
+		{"get weigth lvl10 from metadata", args{resolver.Address{Addr: "", Metadata: float64(Level10)}}, Level10},
+		{"get fractional weight from metadata", args{resolver.Address{Addr: "", Metadata: 0.5}}, 0.5},
+		{"get zero weight from metadata", args{resolver.Address{Addr: "", Metadata: WeightLvl(0)}}, 0},
+		{"get negative weight from metadata", args{resolver.Address{Addr: "", Metadata: float64(-1)}}, 0},
+		{"get default weight from metadata", args{resolver.Address{Addr: ""}}, Level1},
+		{"get default weight from ServerMeta", args{resolver.Address{Addr: "", Metadata: ServerMeta{Zone: "az1"}}}, Level1},
+		{"get zero weight from ServerMeta", args{resolver.Address{Addr: "", Metadata: ServerMeta{Weight: ZeroWeight}}}, 0},
+		{"get default weight from ShardIndex", args{resolver.Address{Addr: "", Metadata: ShardIndex(0)}}, Level1},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := weightFromUpdate(tt.args.u); got != tt.want {
-				t.Errorf("weightFromUpdate() = %v, want %v", got, tt.want)
+			if got := weightFromMetadata(tt.args.addr.Metadata); got != tt.want {
+				t.Errorf("weightFromMetadata() = %v, want %v", got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,48 @@
+package grpclb
+
+// Metrics the hooks to observe the balancers, the nil hooks are skipped.
+// The hooks are called on the pick path, so they should be fast and non-blocking.
+type Metrics struct {
+	// Picked is called when a server is picked by the HashKey,
+	// hops is the number of servers skipped from the owner of the key.
+	Picked func(addr string, hops int)
+	// Fallback is called when a server is picked by the FallbackPolicy.
+	Fallback func(addr string)
+	// PickFailed is called when no server can be picked.
+	PickFailed func(err error)
+	// Updated is called after the updates from the name resolver are applied.
+	Updated func(servers int)
+	// Collided is called when the virtual nodes of two servers are placed at
+	// the same point on the ring.
+	Collided func(addr1, addr2 string)
+}
+
+func (m *Metrics) picked(addr string, hops int) {
+	if m.Picked != nil {
+		m.Picked(addr, hops)
+	}
+}
+
+func (m *Metrics) fallback(addr string) {
+	if m.Fallback != nil {
+		m.Fallback(addr)
+	}
+}
+
+func (m *Metrics) pickFailed(err error) {
+	if m.PickFailed != nil {
+		m.PickFailed(err)
+	}
+}
+
+func (m *Metrics) updated(servers int) {
+	if m.Updated != nil {
+		m.Updated(servers)
+	}
+}
+
+func (m *Metrics) collided(addr1, addr2 string) {
+	if m.Collided != nil {
+		m.Collided(addr1, addr2)
+	}
+}
@@ -0,0 +1,113 @@
+package grpclb
+
+import (
+	"math"
+	"sort"
+)
+
+// DefaultProbes the default number of probes per key of the multi-probe consistent hashing.
+const DefaultProbes = 21
+
+type multiProbeNode struct {
+	point  uint64
+	s      *server
+	weight float64
+}
+
+type multiProbe struct {
+	*pool
+	nodes []multiProbeNode // sorted by point.
+}
+
+func newMultiProbe(p *pool) selector {
+	return &multiProbe{pool: p}
+}
+
+func (mp *multiProbe) add(s *server) {
+	if mp.register(s) && s.weight > 0 {
+		mp.insert(s)
+	}
+}
+
+// insert the server of zero weight is not inserted, so it is never picked.
+func (mp *multiProbe) insert(s *server) {
+	var point uint64
+	if rh, ok := mp.opts.ringHasher.(RingHasher64); ok {
+		point = rh.Sum64([]byte(s.addr.Addr))
+	} else {
+		point = point32(mp.opts.ringHasher.Sum32([]byte(s.addr.Addr)))
+	}
+	n := multiProbeNode{point: point, s: s, weight: float64(s.weight)}
+
+	// the collided points are ordered by the address.
+	idx := sort.Search(len(mp.nodes), func(i int) bool {
+		return mp.nodes[i].point > n.point || mp.nodes[i].point == n.point && mp.nodes[i].s.addr.Addr > s.addr.Addr
+	})
+	mp.nodes = append(mp.nodes, multiProbeNode{})
+	copy(mp.nodes[idx+1:], mp.nodes[idx:])
+	mp.nodes[idx] = n
+}
+
+func (mp *multiProbe) delete(addr string) {
+	if s, ok := mp.unregister(addr); ok {
+		mp.remove(s)
+	}
+}
+
+func (mp *multiProbe) remove(s *server) {
+	for i, n := range mp.nodes {
+		if n.s == s {
+			mp.nodes = append(mp.nodes[:i], mp.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (mp *multiProbe) update(s *server, w WeightLvl) {
+	old := s.weight
+	mp.setWeight(s, w)
+	switch {
+	case old <= 0 && w > 0:
+		mp.insert(s)
+	case w <= 0:
+		mp.remove(s)
+	default:
+		for i := range mp.nodes {
+			if mp.nodes[i].s == s {
+				mp.nodes[i].weight = float64(w)
+			}
+		}
+	}
+}
+
+// walk starts from the server of the closest probe and goes clockwise.
+func (mp *multiProbe) walk(h Hasher, fn func(s *server) bool) {
+	n := len(mp.nodes)
+	if n == 0 {
+		return
+	}
+
+	key := ringKey(h)
+	step := mix64(key) | 1
+	best, bestDist := 0, math.Inf(1)
+	for i := 0; i < mp.opts.probes; i++ {
+		probe := mix64(key + uint64(i)*step)
+		idx := sort.Search(n, func(j int) bool {
+			return mp.nodes[j].point >= probe
+		}) % n
+		// the distance wraps around the ring in uint64.
+		if dist := float64(mp.nodes[idx].point-probe) / mp.nodes[idx].weight; dist < bestDist {
+			best, bestDist = idx, dist
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		if !fn(mp.nodes[(best+i)%n].s) {
+			return
+		}
+	}
+}
+
+func (mp *multiProbe) snapshot(p *pool) selector {
+	return &multiProbe{pool: p, nodes: append([]multiProbeNode(nil), mp.nodes...)}
+}
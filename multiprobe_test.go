@@ -0,0 +1,47 @@
+package grpclb
+
+import (
+	"strconv"
+	"testing"
+)
+
+func Test_multiProbe_add(t *testing.T) {
+	mp := newTestSelector(newMultiProbe, newPool(newOptions(WithRingHasher(XXHash))), Level1, Level1, Level1, Level1).(*multiProbe)
+	if len(mp.nodes) != 4 {
+		t.Fatalf("multiProbe.add() points = %v, want 4", len(mp.nodes))
+	}
+	for i := 1; i < len(mp.nodes); i++ {
+		if mp.nodes[i-1].point > mp.nodes[i].point {
+			t.Errorf("multiProbe.add() points are not sorted")
+		}
+	}
+	mp.delete("127.0.0.1:8081")
+	if len(mp.nodes) != 3 {
+		t.Errorf("multiProbe.delete() points = %v, want 3", len(mp.nodes))
+	}
+}
+
+func Test_multiProbe_walk(t *testing.T) {
+	mp := newTestSelector(newMultiProbe, newPool(newOptions(WithRingHasher(XXHash))), Level1, Level1, Level1, Level1, Level1, Level1, Level1, Level1).(*multiProbe)
+	counts := map[string]int{}
+	for i := 0; i < 40000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		var n int
+		mp.walk(h, func(s *server) bool {
+			if n == 0 {
+				counts[s.addr.Addr]++
+			}
+			n++
+			return true
+		})
+		if n != 8 {
+			t.Fatalf("multiProbe.walk() walked %v servers, want 8", n)
+		}
+	}
+	// the peak-to-mean ratio of 21 probes is about 1.05.
+	for addr, c := range counts {
+		if ratio := float64(c) / 5000; ratio > 1.3 || ratio < 0.7 {
+			t.Errorf("multiProbe picked server(%s) %v times, ratio %v", addr, c, ratio)
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package grpclb
+
+import (
+	"time"
+
+	"golang.org/x/net/context"
+)
+
+// Option configures the balancers.
+type Option interface {
+	apply(*options)
+}
+
+type options struct {
+	f               HasherFromContext
+	ringHasher      RingHasher
+	replicas        ReplicaPolicy
+	libketama       bool
+	ringSize        int
+	maglevTableSize uint64 // a prime.
+	probes          int
+	zone            string
+	loadFactor      float64
+	slowStart       time.Duration
+	healthCheck     *HealthCheck
+	outlier         *OutlierDetection
+	failFast        bool
+	fallback        FallbackPolicy
+	defaultKey      interface{}
+	defaultHasher   Hasher // the defaultKey hashed by f.
+	logger          Logger
+	metrics         Metrics
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		ringHasher:      FNV32a,
+		replicas:        weightReplicas,
+		maglevTableSize: DefaultMaglevTableSize,
+		probes:          DefaultProbes,
+		logger:          grpcLogger{},
+	}
+	for _, opt := range opts {
+		opt.apply(o)
+	}
+	if o.f == nil {
+		o.f = strOrNumFromContextWith(o.ringHasher)
+	}
+	if o.defaultKey != nil {
+		o.defaultHasher = o.hashDefaultKey()
+	}
+	return o
+}
+
+// hashDefaultKey the Hasher is used as is, the other keys are hashed by f as the value
+// of StrOrNumToContext, so the default key is hashed the same as the keys of the RPCs.
+func (o *options) hashDefaultKey() Hasher {
+	if h, ok := o.defaultKey.(Hasher); ok {
+		return h
+	}
+	h, ok := o.f(StrOrNumToContext(context.Background(), o.defaultKey))
+	if !ok {
+		o.logger.Warningf("grpclb: The default key(%v) can not be hashed by the HasherFromContext, pass a Hasher to WithDefaultKey instead.\n", o.defaultKey)
+		return nil
+	}
+	return h
+}
+
+type optionFunc func(*options)
+
+func (f optionFunc) apply(o *options) {
+	f(o)
+}
+
+// apply a HasherFromContext can be passed as an Option directly.
+func (f HasherFromContext) apply(o *options) {
+	o.f = f
+}
+
+// WithHasherFromContext parse the HashKey of the RPC from context by f,
+// the default one parses the value set by StrOrNumToContext and hash it by the RingHasher.
+func WithHasherFromContext(f HasherFromContext) Option {
+	return f
+}
+
+// WithRingHasher hash the servers onto the ring by h, the default is FNV32a.
+// Use MD5Ketama to be compatible with the other ketama clients, or a RingHasher64
+// such as XXHash to place the points in 64-bit hash space.
+func WithRingHasher(h RingHasher) Option {
+	return optionFunc(func(o *options) {
+		o.ringHasher = h
+	})
+}
+
+// WithLibketama generate the same points on the ring as libketama, so the keys are
+// owned by the same servers as the other libketama compatible clients: the MD5 of
+// "addr-i" gives four points per digest, and 160 points per server when the weights
+// are equal. The RingHasher is set to MD5Ketama and the ReplicaPolicy is ignored.
+func WithLibketama() Option {
+	return optionFunc(func(o *options) {
+		o.libketama = true
+		o.ringHasher = MD5Ketama
+	})
+}
+
+// ReplicaPolicy returns the number of the virtual nodes on the ring for a server
+// by its weight.
+type ReplicaPolicy func(w WeightLvl) int
+
+// weightReplicas one virtual node per weight, rounded down.
+func weightReplicas(w WeightLvl) int {
+	return int(w)
+}
+
+// WithReplicaPolicy set the number of virtual nodes of the servers by p,
+// the default is one virtual node per weight, that is 100 for Level1.
+func WithReplicaPolicy(p ReplicaPolicy) Option {
+	return optionFunc(func(o *options) {
+		o.replicas = p
+	})
+}
+
+// WithRingSize normalize the total number of the virtual nodes on the ketama ring to
+// about n, each server takes the share of its weight, so the weights are relative and
+// can be fractional. It precedes WithReplicaPolicy, and each server of non-zero weight
+// has one virtual node at least.
+func WithRingSize(n int) Option {
+	return optionFunc(func(o *options) {
+		o.ringSize = n
+	})
+}
+
+// WithMaglevTableSize set the size of the Maglev lookup table, it is rounded up to
+// a prime and should be much larger than the number of servers, 100 times is good.
+func WithMaglevTableSize(size uint64) Option {
+	return optionFunc(func(o *options) {
+		o.maglevTableSize = nextPrime(size)
+	})
+}
+
+// WithProbes set the number of probes per key of the multi-probe consistent hashing,
+// the more probes, the better balance and the slower pick.
+func WithProbes(k int) Option {
+	return optionFunc(func(o *options) {
+		if k < 1 {
+			k = 1
+		}
+		o.probes = k
+	})
+}
+
+// WithZone pick the servers of the zone first, the servers are grouped by the Zone of
+// their ServerMeta and each zone has its own ring, so the keys stick to their servers
+// within each zone. The RPCs spill to the other zones only when no server of the zone
+// is available. The zone of a server is fixed when it is added.
+func WithZone(zone string) Option {
+	return optionFunc(func(o *options) {
+		o.zone = zone
+	})
+}
+
+// WithBoundedLoad enable the consistent hashing with bounded loads,
+// the in-flight requests of each server is capped at c × average,
+// when the owner of a key is full, the next server clockwise on the ring is picked.
+// The smaller c is, the more keys are moved from their owners, c less than 1 is treated as 1.
+func WithBoundedLoad(c float64) Option {
+	return optionFunc(func(o *options) {
+		if c < 1 {
+			c = 1
+		}
+		o.loadFactor = c
+	})
+}
+
+// WithSlowStart ramp up the share of the keys of a new server from 10% to the full
+// over the window, so the server with cold caches isn't flooded at once. The servers
+// ready when the picker is first built are not slow started, and a server reconnected
+// to the picker is slow started again.
+func WithSlowStart(window time.Duration) Option {
+	return optionFunc(func(o *options) {
+		o.slowStart = window
+	})
+}
+
+// WithHealthCheck check the servers actively by grpc.health.v1.Health/Check, and keep
+// the unhealthy ones out of the picks until they recover. The checker starts with the
+// balancer, the health is kept by the addresses, so it survives the rebuilds of the pickers.
+func WithHealthCheck(hc HealthCheck) Option {
+	return optionFunc(func(o *options) {
+		o.healthCheck = &hc
+	})
+}
+
+// WithOutlierDetection eject the servers of consecutive errors or high error ratios from
+// the picks, and readmit them after the ejection time. The pickers count the errors
+// of the RPCs when they are done.
+func WithOutlierDetection(od OutlierDetection) Option {
+	return optionFunc(func(o *options) {
+		o.outlier = &od
+	})
+}
+
+// WithFailFast fail the pick with ErrServerDisconnected of codes.Unavailable when the
+// owner of a key is not ready, instead of walking to the next ready server on the ring.
+// The servers not ready are kept on the ring, so the keys keep their owners.
+func WithFailFast() Option {
+	return optionFunc(func(o *options) {
+		o.failFast = true
+	})
+}
+
+// WithFallback pick the server by the policy for the RPC without HashKey in the context.
+func WithFallback(p FallbackPolicy) Option {
+	return optionFunc(func(o *options) {
+		o.fallback = p
+	})
+}
+
+// WithDefaultKey use the val as the HashKey for the RPC without HashKey in the context,
+// it precedes WithFallback. The val is a Hasher, or the value of StrOrNumToContext which
+// is hashed by the HasherFromContext, the key which can not be hashed is logged and ignored.
+func WithDefaultKey(val interface{}) Option {
+	return optionFunc(func(o *options) {
+		o.defaultKey = val
+	})
+}
+
+// WithLogger log by l instead of grpclog.
+func WithLogger(l Logger) Option {
+	return optionFunc(func(o *options) {
+		o.logger = l
+	})
+}
+
+// WithMetrics observe the balancers by the hooks of m.
+func WithMetrics(m Metrics) Option {
+	return optionFunc(func(o *options) {
+		o.metrics = m
+	})
+}
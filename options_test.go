@@ -0,0 +1,76 @@
+package grpclb
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/resolver"
+)
+
+func Test_newOptions(t *testing.T) {
+	var called bool
+	f := HasherFromContext(func(ctx context.Context) (Hasher, bool) {
+		called = true
+		return strOrNumFromContext(ctx)
+	})
+
+	tests := []struct {
+		name       string
+		opts       []Option
+		points     int
+		wantCalled bool
+	}{
+		{"default", nil, int(Level1), false},
+		{"HasherFromContext as option", []Option{f}, int(Level1), true},
+		{"replica policy", []Option{WithReplicaPolicy(func(w WeightLvl) int { return int(w) / 10 })}, int(Level1) / 10, false},
+		{"non-positive replicas", []Option{WithReplicaPolicy(func(w WeightLvl) int { return 0 })}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			called = false
+			o := newOptions(tt.opts...)
+			k := newKetama(newPool(o)).(*ketama)
+			k.add(newServer(resolver.Address{Addr: "127.0.0.1:8080", Metadata: float64(Level1)}))
+			k.rebuild()
+			if got := len(k.sortedHashSet); got != tt.points {
+				t.Errorf("ketama.add() points = %v, want %v", got, tt.points)
+			}
+			o.f(context.Background())
+			if called != tt.wantCalled {
+				t.Errorf("options.f called = %v, want %v", called, tt.wantCalled)
+			}
+		})
+	}
+}
+
+func Test_newOptions_defaultKey(t *testing.T) {
+	h, _ := newHasherWith("key", XXHash)
+	f := HasherFromContext(func(ctx context.Context) (Hasher, bool) {
+		return newHasherWith(ctx.Value(strOrNumKey), XXHash)
+	})
+
+	tests := []struct {
+		name string
+		opts []Option
+		want Hasher
+	}{
+		{"hashed by HasherFromContext", []Option{f, WithDefaultKey("key")}, h},
+		{"hashed by RingHasher", []Option{WithRingHasher(XXHash), WithDefaultKey("key")}, h},
+		{"Hasher", []Option{WithDefaultKey(h)}, h},
+		{"unsupported key", []Option{WithDefaultKey(struct{}{})}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := newOptions(tt.opts...)
+			if tt.want == nil {
+				if o.defaultHasher != nil {
+					t.Errorf("newOptions() defaultHasher = %v, want nil", o.defaultHasher)
+				}
+				return
+			}
+			if o.defaultHasher == nil || o.defaultHasher.Hash32() != tt.want.Hash32() {
+				t.Errorf("newOptions() defaultHasher = %v, want %v", o.defaultHasher, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,218 @@
+package grpclb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/tevino/abool"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OutlierDetection configures ejecting the servers of high error rates from the picks,
+// the ejected servers are readmitted after the ejection time, which backs off
+// exponentially when a server is ejected again.
+type OutlierDetection struct {
+	// ConsecutiveErrors eject a server after the consecutive errors, 5 by default.
+	ConsecutiveErrors int
+	// ErrorRatio eject a server when the ratio of the errors in an interval reaches it,
+	// 0 disables the ratio check.
+	ErrorRatio float64
+	// MinRequests the minimum requests in an interval for ErrorRatio, 10 by default.
+	MinRequests int
+	// Interval of the error ratio check and the readmission, 10s by default.
+	Interval time.Duration
+	// BaseEjectionTime the ejection time is BaseEjectionTime × 2^(n-1) for the n-th
+	// ejection, 30s by default.
+	BaseEjectionTime time.Duration
+	// MaxEjectionTime caps the ejection time, 300s by default.
+	MaxEjectionTime time.Duration
+	// MaxEjectionPercent the ejected servers are at most the percent of all servers,
+	// but one server can be ejected at least, 10 by default.
+	MaxEjectionPercent int
+	// Codes the errors counted, the codes.Unknown, codes.DeadlineExceeded, codes.Internal,
+	// codes.Unavailable and codes.DataLoss by default.
+	Codes []codes.Code
+}
+
+func (od OutlierDetection) withDefaults() OutlierDetection {
+	if od.ConsecutiveErrors <= 0 {
+		od.ConsecutiveErrors = 5
+	}
+	if od.MinRequests <= 0 {
+		od.MinRequests = 10
+	}
+	if od.Interval <= 0 {
+		od.Interval = 10 * time.Second
+	}
+	if od.BaseEjectionTime <= 0 {
+		od.BaseEjectionTime = 30 * time.Second
+	}
+	if od.MaxEjectionTime <= 0 {
+		od.MaxEjectionTime = 300 * time.Second
+	}
+	if od.MaxEjectionPercent <= 0 {
+		od.MaxEjectionPercent = 10
+	}
+	if len(od.Codes) == 0 {
+		od.Codes = []codes.Code{codes.Unknown, codes.DeadlineExceeded, codes.Internal, codes.Unavailable, codes.DataLoss}
+	}
+	return od
+}
+
+// outlierDetector tracks the errors of the servers by their addresses, so the states
+// survive the rebuilds of the pickers.
+type outlierDetector struct {
+	od     OutlierDetection
+	codes  map[codes.Code]bool
+	logger Logger
+	done   chan struct{}
+
+	mu    sync.Mutex
+	stats map[string]*outlierStats
+}
+
+// outlierStats the errors of a server.
+type outlierStats struct {
+	// the counters are updated by the RPCs concurrently.
+	requests    uint64
+	errors      uint64
+	consecutive uint64
+	ejected     abool.AtomicBool
+
+	// guarded by the mu of the detector.
+	ejections int
+	until     time.Time
+}
+
+func newOutlierDetector(od OutlierDetection, logger Logger) *outlierDetector {
+	od = od.withDefaults()
+	cs := make(map[codes.Code]bool, len(od.Codes))
+	for _, c := range od.Codes {
+		cs[c] = true
+	}
+	return &outlierDetector{
+		od:     od,
+		codes:  cs,
+		logger: logger,
+		done:   make(chan struct{}),
+		stats:  map[string]*outlierStats{},
+	}
+}
+
+func (d *outlierDetector) run() {
+	ticker := time.NewTicker(d.od.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			d.sweep(now)
+		}
+	}
+}
+
+func (d *outlierDetector) stop() {
+	close(d.done)
+}
+
+// statsOf the stats of the server, it is created at the first time.
+func (d *outlierDetector) statsOf(addr string) *outlierStats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	st, ok := d.stats[addr]
+	if !ok {
+		st = &outlierStats{}
+		d.stats[addr] = st
+	}
+	return st
+}
+
+// retain drops the stats of the servers not in addrs.
+func (d *outlierDetector) retain(addrs map[string]bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for addr := range d.stats {
+		if !addrs[addr] {
+			delete(d.stats, addr)
+		}
+	}
+}
+
+// report counts the result of an RPC on the server.
+func (d *outlierDetector) report(addr string, st *outlierStats, err error) {
+	atomic.AddUint64(&st.requests, 1)
+	if err == nil || !d.codes[status.Code(err)] {
+		atomic.StoreUint64(&st.consecutive, 0)
+		return
+	}
+	atomic.AddUint64(&st.errors, 1)
+	if n := atomic.AddUint64(&st.consecutive, 1); n >= uint64(d.od.ConsecutiveErrors) && !st.ejected.IsSet() {
+		d.mu.Lock()
+		defer d.mu.Unlock()
+		d.eject(addr, st, time.Now())
+	}
+}
+
+// eject the server unless the ejected servers reach MaxEjectionPercent,
+// it must be called with the lock held.
+func (d *outlierDetector) eject(addr string, st *outlierStats, now time.Time) {
+	if st.ejected.IsSet() {
+		return
+	}
+	var ejected int
+	for _, v := range d.stats {
+		if v.ejected.IsSet() {
+			ejected++
+		}
+	}
+	if ejected > 0 && (ejected+1)*100 > d.od.MaxEjectionPercent*len(d.stats) {
+		d.logger.Warningf("grpclb: The server(%s) is not ejected, %d of %d servers have been ejected.\n", addr, ejected, len(d.stats))
+		return
+	}
+
+	st.ejections++
+	ejection := d.od.BaseEjectionTime
+	for i := 1; i < st.ejections && ejection < d.od.MaxEjectionTime; i++ {
+		ejection *= 2
+	}
+	if ejection > d.od.MaxEjectionTime {
+		ejection = d.od.MaxEjectionTime
+	}
+	st.until = now.Add(ejection)
+	st.ejected.Set()
+	atomic.StoreUint64(&st.consecutive, 0)
+	d.logger.Warningf("grpclb: The server(%s) is ejected for %v.\n", addr, ejection)
+}
+
+// sweep readmits the servers whose ejection time is over, and ejects the servers
+// whose error ratio in the interval reaches ErrorRatio.
+func (d *outlierDetector) sweep(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for addr, st := range d.stats {
+		requests, errors := atomic.SwapUint64(&st.requests, 0), atomic.SwapUint64(&st.errors, 0)
+		if st.ejected.IsSet() {
+			if !now.Before(st.until) {
+				st.ejected.UnSet()
+				d.logger.Infof("grpclb: The server(%s) is readmitted.\n", addr)
+			}
+			continue
+		}
+		if d.od.ErrorRatio > 0 && requests >= uint64(d.od.MinRequests) &&
+			float64(errors)/float64(requests) >= d.od.ErrorRatio {
+			d.eject(addr, st, now)
+			continue
+		}
+		if errors == 0 && st.ejections > 0 {
+			// the back-off decays while the server is healthy.
+			st.ejections--
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package grpclb
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newTestOutlierDetector(od OutlierDetection, n int) (*outlierDetector, []*outlierStats) {
+	d := newOutlierDetector(od, grpcLogger{})
+	var stats []*outlierStats
+	for i := 0; i < n; i++ {
+		stats = append(stats, d.statsOf("127.0.0.1:"+strconv.Itoa(8080+i)))
+	}
+	return d, stats
+}
+
+func Test_outlierDetector_report(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	tests := []struct {
+		name        string
+		errs        []error
+		wantEjected bool
+	}{
+		{"consecutive errors", []error{unavailable, unavailable, unavailable}, true},
+		{"reset by success", []error{unavailable, unavailable, nil, unavailable}, false},
+		{"not counted code", []error{status.Error(codes.NotFound, ""), status.Error(codes.NotFound, ""), status.Error(codes.NotFound, "")}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, stats := newTestOutlierDetector(OutlierDetection{ConsecutiveErrors: 3}, 1)
+			for _, err := range tt.errs {
+				d.report("127.0.0.1:8080", stats[0], err)
+			}
+			if got := stats[0].ejected.IsSet(); got != tt.wantEjected {
+				t.Errorf("outlierDetector.report() ejected = %v, want %v", got, tt.wantEjected)
+			}
+		})
+	}
+}
+
+func Test_outlierDetector_eject(t *testing.T) {
+	d, stats := newTestOutlierDetector(OutlierDetection{MaxEjectionPercent: 50}, 4)
+	now := time.Now()
+	for i, st := range stats {
+		d.eject("127.0.0.1:"+strconv.Itoa(8080+i), st, now)
+	}
+	var ejected int
+	for _, st := range stats {
+		if st.ejected.IsSet() {
+			ejected++
+		}
+	}
+	if ejected != 2 {
+		t.Errorf("outlierDetector.eject() ejected = %v, want %v", ejected, 2)
+	}
+
+	// at least one server can be ejected.
+	d, stats = newTestOutlierDetector(OutlierDetection{}, 2)
+	if d.eject("127.0.0.1:8080", stats[0], now); !stats[0].ejected.IsSet() {
+		t.Errorf("outlierDetector.eject() the first server is not ejected")
+	}
+}
+
+func Test_outlierDetector_sweep(t *testing.T) {
+	d, stats := newTestOutlierDetector(OutlierDetection{BaseEjectionTime: time.Second, MaxEjectionTime: 3 * time.Second}, 1)
+	st, now := stats[0], time.Now()
+
+	// the ejection time backs off exponentially up to the max.
+	for i, want := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second} {
+		d.eject("127.0.0.1:8080", st, now)
+		if got := st.until.Sub(now); got != want {
+			t.Errorf("outlierDetector.eject() #%d ejection = %v, want %v", i, got, want)
+		}
+		if d.sweep(now.Add(want - 1)); !st.ejected.IsSet() {
+			t.Errorf("outlierDetector.sweep() #%d readmitted before the ejection time", i)
+		}
+		if d.sweep(now.Add(want)); st.ejected.IsSet() {
+			t.Errorf("outlierDetector.sweep() #%d not readmitted after the ejection time", i)
+		}
+	}
+	// and decays while the server is healthy.
+	d.sweep(now)
+	if st.ejections != 2 {
+		t.Errorf("outlierDetector.sweep() ejections = %v, want %v", st.ejections, 2)
+	}
+}
+
+func Test_outlierDetector_sweep_ratio(t *testing.T) {
+	tests := []struct {
+		name        string
+		requests    int
+		errors      int
+		wantEjected bool
+	}{
+		{"high error ratio", 10, 6, true},
+		{"low error ratio", 10, 4, false},
+		{"too few requests", 4, 4, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d, stats := newTestOutlierDetector(OutlierDetection{ConsecutiveErrors: 100, ErrorRatio: 0.5, MinRequests: 5}, 1)
+			for i := 0; i < tt.requests; i++ {
+				var err error
+				if i < tt.errors {
+					err = status.Error(codes.Internal, "internal")
+				}
+				d.report("127.0.0.1:8080", stats[0], err)
+			}
+			if d.sweep(time.Now()); stats[0].ejected.IsSet() != tt.wantEjected {
+				t.Errorf("outlierDetector.sweep() ejected = %v, want %v", stats[0].ejected.IsSet(), tt.wantEjected)
+			}
+		})
+	}
+}
@@ -0,0 +1,432 @@
+package grpclb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Ketama the name of the ketama balancer, it can be used in the service config
+	// `{"loadBalancingConfig": [{"ketama": {}}]}` set by grpc.WithDefaultServiceConfig.
+	Ketama = "ketama"
+	// JumpHash the name of the jump consistent hash balancer.
+	JumpHash = "jump_hash"
+	// Rendezvous the name of the weighted rendezvous hashing balancer.
+	Rendezvous = "rendezvous"
+	// Maglev the name of the Maglev hashing balancer.
+	Maglev = "maglev"
+	// MultiProbe the name of the multi-probe consistent hashing balancer.
+	MultiProbe = "multi_probe"
+)
+
+func init() {
+	balancer.Register(NewKetamaBuilder(Ketama))
+	balancer.Register(NewJumpHashBuilder(JumpHash))
+	balancer.Register(NewRendezvousBuilder(Rendezvous))
+	balancer.Register(NewMaglevBuilder(Maglev))
+	balancer.Register(NewMultiProbeBuilder(MultiProbe))
+}
+
+// NewKetamaBuilder new a balancer builder with ketama algorithm, the built balancers
+// pick the SubConn by the Hasher parsed from the RPC context.
+func NewKetamaBuilder(name string, opts ...Option) balancer.Builder {
+	return newHashBuilder(name, newKetama, opts...)
+}
+
+// NewJumpHashBuilder new a balancer builder with jump consistent hash algorithm,
+// see https://arxiv.org/abs/1406.2294. The buckets are the ShardIndex in the metadata of
+// the servers, the missing shards and the servers of zero weight are skipped, so the keys
+// of the other shards are not moved, then the servers without ShardIndex follow in the
+// order of the address. It fits the sharded services with a fixed, ordered backend list.
+// It is perfectly balanced and needs no memory for the ring, but the weights of servers
+// are ignored.
+func NewJumpHashBuilder(name string, opts ...Option) balancer.Builder {
+	return newHashBuilder(name, newJumpHash, opts...)
+}
+
+// NewRendezvousBuilder new a balancer builder with weighted rendezvous hashing (highest
+// random weight), every server scores the key by its weight and the highest one owns
+// the key, so no ring is needed and the loads follow the weights exactly.
+func NewRendezvousBuilder(name string, opts ...Option) balancer.Builder {
+	return newHashBuilder(name, newRendezvous, opts...)
+}
+
+// NewMaglevBuilder new a balancer builder with Maglev hashing, see "Maglev: A Fast and
+// Reliable Software Network Load Balancer". The servers are filled into a fixed lookup
+// table in proportion to their weights, so a pick is O(1) and few keys are moved when
+// the servers change. The table is rebuilt in background after each update of the
+// servers, the picks use the previous table until the new one is ready.
+func NewMaglevBuilder(name string, opts ...Option) balancer.Builder {
+	return newHashBuilder(name, newMaglev, opts...)
+}
+
+// NewMultiProbeBuilder new a balancer builder with multi-probe consistent hashing, see
+// https://arxiv.org/abs/1505.00062. Every server has only one point on the ring, the
+// key is hashed k times and the probe closest to its next point wins, the distances
+// are divided by the weights of servers. It needs much less memory than the ketama
+// ring for the same balance.
+func NewMultiProbeBuilder(name string, opts ...Option) balancer.Builder {
+	return newHashBuilder(name, newMultiProbe, opts...)
+}
+
+func newHashBuilder(name string, newSel newSelector, opts ...Option) balancer.Builder {
+	o := newOptions(opts...)
+	if o.zone != "" {
+		newSel = zoned(newSel)
+	}
+	return &hashBuilder{name: name, opts: o, newSel: newSel, conns: map[string]*hashPickerBuilder{}}
+}
+
+var _ Replicator = new(hashBuilder)
+
+// hashBuilder builds the base balancer with a hashPickerBuilder per ClientConn,
+// so the pickers of a ClientConn share the state across the builds.
+type hashBuilder struct {
+	name   string
+	opts   *options
+	newSel newSelector
+
+	mu sync.Mutex
+	// conns the picker builders of the ClientConns by the endpoints of their targets.
+	conns map[string]*hashPickerBuilder
+}
+
+func (hb *hashBuilder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	hpb := newHashPickerBuilder(hb.opts, hb.newSel)
+	b := base.NewBalancerBuilder(hb.name, hpb, base.Config{}).Build(cc, opts)
+	if hpb.checker != nil {
+		go hpb.checker.run()
+	}
+	if hpb.detector != nil {
+		go hpb.detector.run()
+	}
+	endpoint := opts.Target.Endpoint()
+	hb.mu.Lock()
+	hb.conns[endpoint] = hpb
+	hb.mu.Unlock()
+	return &hashBalancer{Balancer: b, hpb: hpb, hb: hb, endpoint: endpoint}
+}
+
+// Successors the replicas on the last ClientConn built for the endpoint, such as "service"
+// of the target "etcd:///service". The addresses carry no Metadata.
+func (hb *hashBuilder) Successors(endpoint string, key Hasher, n int) []resolver.Address {
+	hb.mu.Lock()
+	hpb, ok := hb.conns[endpoint]
+	hb.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	hp, ok := hpb.latest.Load().(*hashPicker)
+	if !ok {
+		return nil
+	}
+	var as []resolver.Address
+	for _, s := range replicas(hp.sel, key, n) {
+		as = append(as, resolver.Address{Addr: s.addr.Addr, ServerName: s.addr.ServerName})
+	}
+	return as
+}
+
+// hashBalancer applies the addresses of the name resolver to the picker builder, and
+// runs the health checker and the outlier detector with the balancer.
+type hashBalancer struct {
+	balancer.Balancer
+	hpb      *hashPickerBuilder
+	hb       *hashBuilder
+	endpoint string
+}
+
+// UpdateClientConnState applies the servers of the name resolver before the base balancer
+// builds the picker. The states of the servers removed are dropped, the servers not ready
+// are kept, so a flapping server keeps its health, ejection and back-off when it is ready again.
+func (b *hashBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	b.hpb.update(s.ResolverState.Addresses)
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+func (b *hashBalancer) Close() {
+	b.hb.mu.Lock()
+	if b.hb.conns[b.endpoint] == b.hpb {
+		delete(b.hb.conns, b.endpoint)
+	}
+	b.hb.mu.Unlock()
+	b.Balancer.Close()
+	if b.hpb.checker != nil {
+		b.hpb.checker.stop()
+	}
+	if b.hpb.detector != nil {
+		b.hpb.detector.stop()
+	}
+}
+
+func (b *hashBalancer) ExitIdle() {
+	if ei, ok := b.Balancer.(balancer.ExitIdler); ok {
+		ei.ExitIdle()
+	}
+}
+
+func (hb *hashBuilder) Name() string {
+	return hb.name
+}
+
+// hashPickerBuilder keeps the live pool and selector of a ClientConn. The servers are
+// added and deleted by the name resolver, they stay on the selector when they are not
+// ready, so the keys keep their owners. The builds mark the ready servers, then the
+// picker takes a snapshot of them. It is called by the balancer serially.
+type hashPickerBuilder struct {
+	*pool
+	sel selector
+	// built the picker has been built with the ready servers.
+	built bool
+	// latest the last picker built with the ready servers, it is read by Successors.
+	latest atomic.Value // *hashPicker
+	// checker keeps the health of the servers across the builds.
+	checker *healthChecker
+	// detector keeps the errors of the servers across the builds.
+	detector *outlierDetector
+}
+
+func newHashPickerBuilder(opts *options, newSel newSelector) *hashPickerBuilder {
+	p := newPool(opts)
+	hpb := &hashPickerBuilder{pool: p, sel: newSel(p)}
+	if opts.healthCheck != nil {
+		hpb.checker = newHealthChecker(*opts.healthCheck, opts.logger)
+	}
+	if opts.outlier != nil {
+		hpb.detector = newOutlierDetector(*opts.outlier, opts.logger)
+	}
+	return hpb
+}
+
+// update applies the diff of the addresses of the name resolver to the selector.
+func (hpb *hashPickerBuilder) update(addrs []resolver.Address) {
+	resolved := make(map[string]bool, len(addrs))
+	for _, addr := range addrs {
+		resolved[addr.Addr] = true
+	}
+	if hpb.checker != nil {
+		hpb.checker.retain(resolved)
+	}
+	if hpb.detector != nil {
+		hpb.detector.retain(resolved)
+	}
+	for _, s := range append([]*server(nil), hpb.list...) {
+		if !resolved[s.addr.Addr] {
+			hpb.sel.delete(s.addr.Addr)
+		}
+	}
+	for _, addr := range addrs {
+		if s, ok := hpb.servers[addr.Addr]; ok {
+			hpb.modify(s, addr.Metadata)
+			continue
+		}
+		hpb.sel.add(hpb.newServer(addr, time.Time{}))
+	}
+	hpb.opts.metrics.updated(len(hpb.servers))
+}
+
+// modify applies the metadata of the resolved server. The base balancer keys the SubConns
+// by the addresses without the metadata, so the changes are only seen here.
+func (hpb *hashPickerBuilder) modify(s *server, metadata interface{}) {
+	meta := metaFromMetadata(metadata)
+	draining := meta.State == Draining
+	s.draining.SetTo(draining)
+	if draining {
+		// the server is drained as is, so its keys are not moved.
+		s.meta.State = Draining
+		return
+	}
+	if meta.Shard != s.meta.Shard || meta.Sharded != s.meta.Sharded {
+		// the server is placed by its shard when it is added.
+		hpb.sel.delete(s.addr.Addr)
+		s = renewServer(s, s.started)
+		s.meta.Shard, s.meta.Sharded = meta.Shard, meta.Sharded
+		hpb.sel.add(s)
+	}
+	if zs, ok := hpb.sel.(*zoneSelector); ok && meta.Zone != s.meta.Zone {
+		s = zs.rezone(s, meta.Zone)
+	}
+	if w := weightFromMetadata(metadata); w != s.weight {
+		hpb.sel.update(s, w)
+	}
+	s.meta = meta
+}
+
+// Build marks the ready servers connected, then the selector is rebuilt and snapshotted.
+func (hpb *hashPickerBuilder) Build(info base.PickerBuildInfo) balancer.Picker {
+	subConns := make(map[string]balancer.SubConn, len(info.ReadySCs))
+	for sc, sci := range info.ReadySCs {
+		subConns[sci.Address.Addr] = sc
+	}
+	if len(subConns) == 0 {
+		for _, s := range hpb.list {
+			s.connected.UnSet()
+		}
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+
+	// the servers ready when the picker is first built are not slow started.
+	var started time.Time
+	if hpb.opts.slowStart > 0 && hpb.built {
+		started = time.Now()
+	}
+	hpb.built = true
+	for _, s := range append([]*server(nil), hpb.list...) {
+		_, ready := subConns[s.addr.Addr]
+		switch {
+		case ready && !s.connected.IsSet() && !started.IsZero():
+			// a new server is slow started, the server read by the pickers is not changed.
+			hpb.sel.delete(s.addr.Addr)
+			s = renewServer(s, started)
+			hpb.sel.add(s)
+		case !ready && s.connected.IsSet():
+			// the server is kept on the selector, so its keys are not moved.
+			s.connected.UnSet()
+		}
+		if ready {
+			s.connected.Set()
+		}
+	}
+
+	build := func() {}
+	if r, ok := hpb.sel.(rebuilder); ok {
+		build = r.rebuild()
+	}
+	p := hpb.pool.snapshot()
+	hp := &hashPicker{
+		pool:     p,
+		sel:      hpb.sel.snapshot(p),
+		subConns: subConns,
+		detector: hpb.detector,
+	}
+	hpb.latest.Store(hp)
+	go build()
+	return hp
+}
+
+// newServer new a server of addr with the health and the errors kept by its address.
+func (hpb *hashPickerBuilder) newServer(addr resolver.Address, started time.Time) *server {
+	s := newServer(addr)
+	s.started = started
+	if hpb.checker != nil {
+		s.health = hpb.checker.stateOf(addr.Addr)
+	}
+	if hpb.detector != nil {
+		s.outlier = hpb.detector.statsOf(addr.Addr)
+	}
+	return s
+}
+
+// renewServer copies s to a new server started at started, the loads are not copied,
+// so the in-flight requests of s are still released to s.
+func renewServer(s *server, started time.Time) *server {
+	ns := &server{addr: s.addr, meta: s.meta, weight: s.weight, started: started, health: s.health, outlier: s.outlier}
+	ns.connected.SetTo(s.connected.IsSet())
+	ns.draining.SetTo(s.draining.IsSet())
+	return ns
+}
+
+// hashPicker picks on the snapshot of the selector, so Pick is lock free.
+// The loads are shared by the pickers of the builder.
+type hashPicker struct {
+	*pool
+	sel      selector
+	subConns map[string]balancer.SubConn
+	detector *outlierDetector
+}
+
+func (hp *hashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	s, err := hp.pick(info.Ctx)
+	if err != nil {
+		hp.opts.metrics.pickFailed(err)
+		if err == ErrNoHashKey {
+			// the RPC fails at once, it is neither waited for ready nor retried.
+			err = status.Error(codes.InvalidArgument, err.Error())
+		}
+		return balancer.PickResult{}, err
+	}
+	sc, ok := hp.subConns[s.addr.Addr]
+	if !ok {
+		// the server is not ready, the RPC waits for the next picker if it is not fail fast.
+		return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+	}
+	hp.acquire(s)
+	return balancer.PickResult{
+		SubConn: sc,
+		Done: func(info balancer.DoneInfo) {
+			hp.release(s)
+			if s.outlier != nil {
+				hp.detector.report(s.addr.Addr, s.outlier, info.Err)
+			}
+		},
+	}, nil
+}
+
+// available the server is ready in the picker and takes new RPCs.
+func (hp *hashPicker) available(s *server) bool {
+	_, ok := hp.subConns[s.addr.Addr]
+	return ok && s.active()
+}
+
+func (hp *hashPicker) pick(ctx context.Context) (*server, error) {
+	h, ok := hp.opts.f(ctx)
+	if !ok {
+		if hp.opts.defaultHasher == nil {
+			return hp.pickFallback()
+		}
+		h = hp.opts.defaultHasher
+	}
+	// the owner is the k-th replica when it is set by ReplicaToContext.
+	k := replicaFromContext(ctx, hp.sel, h)
+	owner, _, err := search(hp.sel, h, skipReplicas(k, (*server).active))
+	if err == ErrNoServer {
+		// all servers are draining, unhealthy or ejected.
+		owner, _, err = search(hp.sel, h, skipReplicas(k, acceptAll))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := hp.subConns[owner.addr.Addr]; !ok && hp.opts.failFast {
+		return nil, status.Error(codes.Unavailable, ErrServerDisconnected.Error())
+	}
+
+	accept := hp.available
+	if hp.opts.loadFactor > 0 {
+		underLoad := hp.sel.underLoad(hp.opts.loadFactor)
+		accept = func(s *server) bool {
+			return hp.available(s) && underLoad(s)
+		}
+	}
+	s, hops, err := search(hp.sel, h, skipReplicas(k, hp.slowStart(h, accept)))
+	if err != nil && (hp.opts.loadFactor > 0 || hp.opts.slowStart > 0) {
+		// all available servers are full because of the concurrent picks, or in slow start.
+		s, hops, err = search(hp.sel, h, skipReplicas(k, hp.available))
+	}
+	if err != nil {
+		// there is no available server, grpc waits on the owner if the RPC is not fail fast.
+		s, hops = owner, k
+	}
+	hp.opts.metrics.picked(s.addr.Addr, hops-k)
+	return s, nil
+}
+
+func (hp *hashPicker) pickFallback() (*server, error) {
+	s, err := hp.fallback(hp.opts.fallback, hp.available)
+	if err == ErrNoServer {
+		// there is no available server, grpc waits on it if the RPC is not fail fast.
+		s, err = hp.fallback(hp.opts.fallback, acceptAll)
+	}
+	if err != nil {
+		return nil, err
+	}
+	hp.opts.metrics.fallback(s.addr.Addr)
+	return s, nil
+}
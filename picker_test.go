@@ -0,0 +1,413 @@
+package grpclb
+
+import (
+	"net"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+)
+
+type testSubConn struct {
+	addr string
+}
+
+func (sc *testSubConn) UpdateAddresses([]resolver.Address) {}
+
+func (sc *testSubConn) Connect() {}
+
+func (sc *testSubConn) GetOrBuildProducer(balancer.ProducerBuilder) (balancer.Producer, func()) {
+	return nil, func() {}
+}
+
+// newTestBuildInfo the ready SubConns of the addresses.
+func newTestBuildInfo(addrs ...resolver.Address) base.PickerBuildInfo {
+	info := base.PickerBuildInfo{ReadySCs: map[balancer.SubConn]base.SubConnInfo{}}
+	for _, addr := range addrs {
+		info.ReadySCs[&testSubConn{addr.Addr}] = base.SubConnInfo{Address: addr}
+	}
+	return info
+}
+
+// newTestPicker resolves the addresses and builds the picker with them all ready.
+func newTestPicker(hpb *hashPickerBuilder, addrs ...resolver.Address) balancer.Picker {
+	hpb.update(addrs)
+	return hpb.Build(newTestBuildInfo(addrs...))
+}
+
+func Test_hashPicker_Pick(t *testing.T) {
+	p := newTestPicker(newHashPickerBuilder(newOptions(), newKetama),
+		resolver.Address{Addr: "127.0.0.1:8080", Metadata: float64(Level1)},
+		resolver.Address{Addr: "127.0.0.1:8081", Metadata: float64(Level1)},
+	)
+
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		wantCode codes.Code
+	}{
+		{"no hash key", context.Background(), codes.InvalidArgument},
+		{"string key", StrOrNumToContext(context.Background(), "key"), codes.OK},
+		{"uint32 key", StrOrNumToContext(context.Background(), uint32(123)), codes.OK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res, err := p.Pick(balancer.PickInfo{Ctx: tt.ctx})
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("hashPicker.Pick() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if err != nil {
+				return
+			}
+			again, _ := p.Pick(balancer.PickInfo{Ctx: tt.ctx})
+			if res.SubConn != again.SubConn {
+				t.Errorf("hashPicker.Pick() = %v, then %v", res.SubConn, again.SubConn)
+			}
+		})
+	}
+}
+
+func Test_hashPickerBuilder_Build(t *testing.T) {
+	p := newHashPickerBuilder(newOptions(), newKetama).Build(newTestBuildInfo())
+	if _, err := p.Pick(balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")}); err != balancer.ErrNoSubConnAvailable {
+		t.Errorf("hashPicker.Pick() error = %v, wantErr %v", err, balancer.ErrNoSubConnAvailable)
+	}
+}
+
+func Test_hashPicker_pick_draining(t *testing.T) {
+	hp := newTestPicker(newHashPickerBuilder(newOptions(), newKetama),
+		resolver.Address{Addr: "127.0.0.1:8080", Metadata: Draining},
+		resolver.Address{Addr: "127.0.0.1:8081"},
+	).(*hashPicker)
+	for i := 0; i < 10; i++ {
+		s, err := hp.pick(StrOrNumToContext(context.Background(), strconv.Itoa(i)))
+		if err != nil || s.addr.Addr != "127.0.0.1:8081" {
+			t.Errorf("hashPicker.pick() = %v, %v, picked the draining server", s.addr.Addr, err)
+		}
+	}
+}
+
+func Test_hashPicker_metrics(t *testing.T) {
+	var picked, fallback int
+	hpb := newHashPickerBuilder(newOptions(WithFallback(RoundRobin), WithMetrics(Metrics{
+		Picked:   func(addr string, hops int) { picked++ },
+		Fallback: func(addr string) { fallback++ },
+	})), newKetama)
+	p := newTestPicker(hpb, resolver.Address{Addr: "127.0.0.1:8080"}, resolver.Address{Addr: "127.0.0.1:8081"})
+	p.Pick(balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")})
+	p.Pick(balancer.PickInfo{Ctx: context.Background()})
+	if picked != 1 || fallback != 1 {
+		t.Errorf("Metrics picked = %v, fallback = %v, want 1, 1", picked, fallback)
+	}
+}
+
+func Test_hashPickerBuilder_Build_loads(t *testing.T) {
+	info := newTestBuildInfo(resolver.Address{Addr: "127.0.0.1:8080"}, resolver.Address{Addr: "127.0.0.1:8081"})
+	hpb := newHashPickerBuilder(newOptions(), newKetama)
+	hpb.update([]resolver.Address{{Addr: "127.0.0.1:8080"}, {Addr: "127.0.0.1:8081"}})
+	res, _ := hpb.Build(info).Pick(balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")})
+
+	// the in-flight request of the previous picker is counted by the next one.
+	hp := hpb.Build(info).(*hashPicker)
+	var conns uint64
+	for _, s := range hp.list {
+		conns += atomic.LoadUint64(&s.currConns)
+	}
+	if total := atomic.LoadUint64(&hp.totalConns); conns != 1 || total != 1 {
+		t.Errorf("hashPickerBuilder.Build() currConns = %v, totalConns = %v, want 1, 1", conns, total)
+	}
+	res.Done(balancer.DoneInfo{})
+	if total := atomic.LoadUint64(&hp.totalConns); total != 0 {
+		t.Errorf("hashPicker.Pick() Done totalConns = %v, want 0", total)
+	}
+}
+
+func Test_hashPickerBuilder_Build_diff(t *testing.T) {
+	hpb := newHashPickerBuilder(newOptions(), newKetama)
+	a, b := resolver.Address{Addr: "127.0.0.1:8080"}, resolver.Address{Addr: "127.0.0.1:8081"}
+	hp := newTestPicker(hpb, a, b).(*hashPicker)
+	sel, kept := hpb.sel, hp.servers[a.Addr]
+
+	// only the removed server is deleted, the others are kept by the live selector.
+	hp = newTestPicker(hpb, a).(*hashPicker)
+	if hpb.sel != sel || hp.servers[a.Addr] != kept || len(hp.servers) != 1 {
+		t.Errorf("hashPickerBuilder.Build() servers = %v, rebuilt the selector", hp.servers)
+	}
+	s, err := hp.pick(StrOrNumToContext(context.Background(), "key"))
+	if err != nil || s != kept {
+		t.Errorf("hashPicker.pick() = %v, %v, want %v", s, err, kept)
+	}
+}
+
+func Test_hashPickerBuilder_update_modify(t *testing.T) {
+	hpb := newHashPickerBuilder(newOptions(), newJumpHash)
+	a, b := resolver.Address{Addr: "127.0.0.1:8080", Metadata: ShardIndex(0)}, resolver.Address{Addr: "127.0.0.1:8081", Metadata: ShardIndex(1)}
+	newTestPicker(hpb, a, b)
+
+	a.Metadata, b.Metadata = ServerMeta{Weight: Level2, Shard: 1, Sharded: true}, ServerMeta{Shard: 0, Sharded: true}
+	hp := newTestPicker(hpb, a, b).(*hashPicker)
+	if s := hp.servers[a.Addr]; s.weight != Level2 || s.meta.Shard != 1 {
+		t.Errorf("hashPickerBuilder.update() weight = %v, shard = %v, want %v, 1", s.weight, s.meta.Shard, Level2)
+	}
+	if shards := hpb.sel.(*jumpHash).shards; len(shards) != 2 || shards[0].addr.Addr != b.Addr {
+		t.Errorf("hashPickerBuilder.update() shards = %v, want %v first", shards, b.Addr)
+	}
+}
+
+func Test_hashPickerBuilder_slowStart(t *testing.T) {
+	hpb := newHashPickerBuilder(newOptions(WithSlowStart(time.Hour)), newKetama)
+	var addrs []resolver.Address
+	build := func(added ...string) *hashPicker {
+		for _, addr := range added {
+			addrs = append(addrs, resolver.Address{Addr: addr})
+		}
+		return newTestPicker(hpb, addrs...).(*hashPicker)
+	}
+
+	hp := build("127.0.0.1:8080", "127.0.0.1:8081")
+	for _, s := range hp.list {
+		if !s.started.IsZero() {
+			t.Errorf("hashPickerBuilder.Build() the first server(%s) is slow started", s.addr.Addr)
+		}
+	}
+	hp = build("127.0.0.1:8082")
+	for _, s := range hp.list {
+		if got, want := !s.started.IsZero(), s.addr.Addr == "127.0.0.1:8082"; got != want {
+			t.Errorf("hashPickerBuilder.Build() server(%s) slow started = %v, want %v", s.addr.Addr, got, want)
+		}
+	}
+}
+
+func Test_hashPicker_Pick_outlier(t *testing.T) {
+	info := newTestBuildInfo(resolver.Address{Addr: "127.0.0.1:8080"}, resolver.Address{Addr: "127.0.0.1:8081"})
+	o := newOptions(WithOutlierDetection(OutlierDetection{ConsecutiveErrors: 2}))
+	hpb := newHashPickerBuilder(o, newKetama)
+	hpb.update([]resolver.Address{{Addr: "127.0.0.1:8080"}, {Addr: "127.0.0.1:8081"}})
+	p := hpb.Build(info)
+	pi := balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")}
+
+	owner, _ := p.Pick(pi)
+	for i := 0; i < 2; i++ {
+		res, _ := p.Pick(pi)
+		res.Done(balancer.DoneInfo{Err: status.Error(codes.Unavailable, "unavailable")})
+	}
+	if res, _ := p.Pick(pi); res.SubConn == owner.SubConn {
+		t.Errorf("hashPicker.Pick() = %v, picked the ejected server", res.SubConn)
+	}
+	// the ejection survives the rebuild.
+	if res, _ := hpb.Build(info).Pick(pi); res.SubConn == owner.SubConn {
+		t.Errorf("hashPicker.Pick() = %v, picked the ejected server after the rebuild", res.SubConn)
+	}
+	// and the server flapping out of the ready servers.
+	flapped := newTestBuildInfo()
+	for sc, sci := range info.ReadySCs {
+		if sc != owner.SubConn {
+			flapped.ReadySCs[sc] = sci
+		}
+	}
+	hpb.Build(flapped)
+	if res, _ := hpb.Build(info).Pick(pi); res.SubConn == owner.SubConn {
+		t.Errorf("hashPicker.Pick() = %v, picked the ejected server after it flapped", res.SubConn)
+	}
+}
+
+func Test_hashPicker_Pick_failFast(t *testing.T) {
+	addrs := []resolver.Address{{Addr: "127.0.0.1:8080"}, {Addr: "127.0.0.1:8081"}}
+	pi := balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")}
+	owner, _ := newTestPicker(newHashPickerBuilder(newOptions(), newKetama), addrs...).(*hashPicker).pick(pi.Ctx)
+	var other resolver.Address
+	for _, addr := range addrs {
+		if addr.Addr != owner.addr.Addr {
+			other = addr
+		}
+	}
+
+	tests := []struct {
+		name     string
+		opts     []Option
+		wantCode codes.Code
+	}{
+		{"next ready server", nil, codes.OK},
+		{"fail fast", []Option{WithFailFast()}, codes.Unavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hpb := newHashPickerBuilder(newOptions(tt.opts...), newKetama)
+			hpb.update(addrs)
+			// the owner is resolved but not ready.
+			p := hpb.Build(newTestBuildInfo(other))
+			res, err := p.Pick(pi)
+			if status.Code(err) != tt.wantCode {
+				t.Errorf("hashPicker.Pick() error = %v, want code %v", err, tt.wantCode)
+				return
+			}
+			if err == nil && res.SubConn.(*testSubConn).addr != other.Addr {
+				t.Errorf("hashPicker.Pick() = %v, want %v", res.SubConn, other.Addr)
+			}
+		})
+	}
+}
+
+type testBalancer struct {
+	balancer.Balancer
+}
+
+func (testBalancer) UpdateClientConnState(balancer.ClientConnState) error {
+	return nil
+}
+
+func Test_hashBalancer_UpdateClientConnState(t *testing.T) {
+	o := newOptions(WithOutlierDetection(OutlierDetection{}))
+	b := &hashBalancer{Balancer: testBalancer{}, hpb: newHashPickerBuilder(o, newKetama)}
+	kept, removed := b.hpb.detector.statsOf("127.0.0.1:8080"), b.hpb.detector.statsOf("127.0.0.1:8081")
+	b.UpdateClientConnState(balancer.ClientConnState{ResolverState: resolver.State{
+		Addresses: []resolver.Address{{Addr: "127.0.0.1:8080"}},
+	}})
+	if got := b.hpb.detector.statsOf("127.0.0.1:8080"); got != kept {
+		t.Errorf("hashBalancer.UpdateClientConnState() dropped the stats of the resolved server")
+	}
+	if got := b.hpb.detector.statsOf("127.0.0.1:8081"); got == removed {
+		t.Errorf("hashBalancer.UpdateClientConnState() kept the stats of the removed server")
+	}
+}
+
+func Test_hashPicker_Pick_unhealthy(t *testing.T) {
+	info := newTestBuildInfo(resolver.Address{Addr: "127.0.0.1:8080"}, resolver.Address{Addr: "127.0.0.1:8081"})
+	o := newOptions(WithHealthCheck(HealthCheck{}))
+	hpb := newHashPickerBuilder(o, newKetama)
+	hpb.update([]resolver.Address{{Addr: "127.0.0.1:8080"}, {Addr: "127.0.0.1:8081"}})
+	p := hpb.Build(info)
+	pi := balancer.PickInfo{Ctx: StrOrNumToContext(context.Background(), "key")}
+
+	owner, _ := p.Pick(pi)
+	owner.Done(balancer.DoneInfo{})
+	for addr, sc := range p.(*hashPicker).subConns {
+		if sc == owner.SubConn {
+			hpb.checker.stateOf(addr).unhealthy.Set()
+		}
+	}
+	// the health survives the rebuild.
+	if res, _ := hpb.Build(info).Pick(pi); res.SubConn == owner.SubConn {
+		t.Errorf("hashPicker.Pick() = %v, picked the unhealthy server after the rebuild", res.SubConn)
+	}
+}
+
+// newTestServer serves the health checks, and counts the RPCs handled.
+func newTestServer(t *testing.T) (addr string, handled *uint64, stop func()) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("net.Listen() error = %v", err)
+	}
+	handled = new(uint64)
+	gs := grpc.NewServer(grpc.UnaryInterceptor(func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		atomic.AddUint64(handled, 1)
+		return handler(ctx, req)
+	}))
+	healthpb.RegisterHealthServer(gs, health.NewServer())
+	go gs.Serve(lis)
+	return lis.Addr().String(), handled, gs.Stop
+}
+
+func Test_hashBalancer_metadata(t *testing.T) {
+	addr1, handled1, stop1 := newTestServer(t)
+	defer stop1()
+	addr2, handled2, stop2 := newTestServer(t)
+	defer stop2()
+
+	r := manual.NewBuilderWithScheme("grpclb-test")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: addr1}, {Addr: addr2}}})
+	cc, err := grpc.Dial(r.Scheme()+":///test", grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"ketama": {}}]}`))
+	if err != nil {
+		t.Fatalf("grpc.Dial() error = %v", err)
+	}
+	defer cc.Close()
+
+	client := healthpb.NewHealthClient(cc)
+	// check sends the RPCs of 20 keys, and returns the RPCs handled by each server.
+	check := func() (uint64, uint64) {
+		n1, n2 := atomic.LoadUint64(handled1), atomic.LoadUint64(handled2)
+		for i := 0; i < 20; i++ {
+			ctx, cancel := context.WithTimeout(StrOrNumToContext(context.Background(), strconv.Itoa(i)), 5*time.Second)
+			_, err := client.Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true))
+			cancel()
+			if err != nil {
+				t.Fatalf("HealthClient.Check() error = %v", err)
+			}
+		}
+		return atomic.LoadUint64(handled1) - n1, atomic.LoadUint64(handled2) - n2
+	}
+	if n1, n2 := check(); n1 == 0 || n2 == 0 {
+		t.Fatalf("HealthClient.Check() handled = %v, %v, want both", n1, n2)
+	}
+
+	// only the metadata of the address is changed.
+	r.UpdateState(resolver.State{Addresses: []resolver.Address{
+		{Addr: addr1, Metadata: ServerMeta{State: Draining}},
+		{Addr: addr2},
+	}})
+	// the picker is built asynchronously.
+	for i := 0; ; i++ {
+		n1, _ := check()
+		if n1 == 0 {
+			break
+		}
+		if i == 50 {
+			t.Fatalf("HealthClient.Check() handled = %v by the draining server", n1)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func Test_hashBuilder_Successors(t *testing.T) {
+	addr1, _, stop1 := newTestServer(t)
+	defer stop1()
+	addr2, _, stop2 := newTestServer(t)
+	defer stop2()
+
+	r := manual.NewBuilderWithScheme("grpclb-test")
+	r.InitialState(resolver.State{Addresses: []resolver.Address{{Addr: addr1}, {Addr: addr2}}})
+	cc, err := grpc.Dial(r.Scheme()+":///successors", grpc.WithResolvers(r),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingConfig": [{"ketama": {}}]}`))
+	if err != nil {
+		t.Fatalf("grpc.Dial() error = %v", err)
+	}
+	ctx, cancel := context.WithTimeout(StrOrNumToContext(context.Background(), "key"), 5*time.Second)
+	defer cancel()
+	if _, err := healthpb.NewHealthClient(cc).Check(ctx, &healthpb.HealthCheckRequest{}, grpc.WaitForReady(true)); err != nil {
+		t.Fatalf("HealthClient.Check() error = %v", err)
+	}
+
+	rep := balancer.Get(Ketama).(Replicator)
+	h, _ := newStrOrNum("key")
+	as := rep.Successors("successors", h, 3)
+	if len(as) != 2 || as[0].Addr == as[1].Addr {
+		t.Fatalf("hashBuilder.Successors() = %v, want 2 distinct servers", as)
+	}
+	k := newKetama(newPool(newOptions()))
+	k.add(newServer(resolver.Address{Addr: addr1}))
+	k.add(newServer(resolver.Address{Addr: addr2}))
+	k.(rebuilder).rebuild()()
+	if owner, _ := lookup(k, h); as[0].Addr != owner.addr.Addr {
+		t.Errorf("hashBuilder.Successors() owner = %v, want %v", as[0].Addr, owner.addr.Addr)
+	}
+	cc.Close()
+	if as := rep.Successors("successors", h, 3); as != nil {
+		t.Errorf("hashBuilder.Successors() = %v after the ClientConn is closed", as)
+	}
+}
@@ -0,0 +1,147 @@
+package grpclb
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// pool the servers registered by the name resolver, it is shared by the balancer
+// and the selector which places the servers by the hashing algorithm.
+type pool struct {
+	*counters
+	servers map[string]*server
+	list    []*server
+	// zero the addresses of the servers of zero weight, the pickers read it instead of
+	// the weights, which are changed in place by the writers.
+	zero map[string]bool
+	opts *options
+}
+
+// counters the loads of the pool, they are shared by the snapshots of the pool.
+type counters struct {
+	totalConns uint64 // keep 64-bit aligned for atomic operations.
+	next       uint64
+	// zones the loads of each zone, it is only accessed by the writers.
+	zones map[string]*counters
+}
+
+// zone returns the loads of the zone, they are created at the first time.
+func (c *counters) zone(name string) *counters {
+	if c.zones == nil {
+		c.zones = map[string]*counters{}
+	}
+	zc, ok := c.zones[name]
+	if !ok {
+		zc = &counters{}
+		c.zones[name] = zc
+	}
+	return zc
+}
+
+func newPool(opts *options) *pool {
+	return &pool{
+		counters: &counters{},
+		servers:  map[string]*server{},
+		opts:     opts,
+	}
+}
+
+// snapshot returns a read-only copy of the pool, the counters are shared.
+func (p *pool) snapshot() *pool {
+	servers := make(map[string]*server, len(p.servers))
+	for addr, s := range p.servers {
+		servers[addr] = s
+	}
+	var zero map[string]bool
+	if len(p.zero) > 0 {
+		zero = make(map[string]bool, len(p.zero))
+		for addr := range p.zero {
+			zero[addr] = true
+		}
+	}
+	return &pool{
+		counters: p.counters,
+		servers:  servers,
+		list:     append([]*server(nil), p.list...),
+		zero:     zero,
+		opts:     p.opts,
+	}
+}
+
+// register adds the server, it returns false if the server has existed.
+func (p *pool) register(s *server) bool {
+	addr := s.addr.Addr
+	if _, ok := p.servers[addr]; ok {
+		p.opts.logger.Warningf("grpclb: The name resolver added an exisited server(%s).\n", addr)
+		return false
+	}
+	p.servers[addr] = s
+	p.list = append(p.list, s)
+	p.setWeight(s, s.weight)
+	return true
+}
+
+// unregister removes the server of addr, it returns false if the server has not existed.
+func (p *pool) unregister(addr string) (*server, bool) {
+	s, ok := p.servers[addr]
+	if !ok {
+		p.opts.logger.Warningf("grpclb: The name resolver deleted an unexistd server(%s).\n", addr)
+		return nil, false
+	}
+	delete(p.servers, addr)
+	delete(p.zero, addr)
+	for i, v := range p.list {
+		if v == s {
+			p.list = append(p.list[:i], p.list[i+1:]...)
+			break
+		}
+	}
+	return s, true
+}
+
+// setWeight changes the weight of the server in place, it is called by the writers.
+func (p *pool) setWeight(s *server, w WeightLvl) {
+	s.weight = w
+	if w > 0 {
+		delete(p.zero, s.addr.Addr)
+		return
+	}
+	if p.zero == nil {
+		p.zero = map[string]bool{}
+	}
+	p.zero[s.addr.Addr] = true
+}
+
+// underLoad returns an accept func for search, which implements the consistent hashing
+// with bounded loads, see https://arxiv.org/abs/1608.01350.
+// It accepts the servers whose in-flight requests are under c × average, the servers of
+// zero weight take no keys, so they are not counted in the average. The loads are
+// read without locking, so the bound is approximate under concurrency.
+func (p *pool) underLoad(c float64) func(s *server) bool {
+	n := len(p.servers) - len(p.zero)
+	if n == 0 {
+		n = 1
+	}
+	limit := uint64(math.Ceil(c * float64(atomic.LoadUint64(&p.totalConns)+1) / float64(n)))
+	return func(s *server) bool {
+		return atomic.LoadUint64(&s.currConns) < limit
+	}
+}
+
+// acquire counts a new in-flight request on the server.
+func (p *pool) acquire(s *server) {
+	atomic.AddUint64(&s.currConns, 1)
+	atomic.AddUint64(&p.totalConns, 1)
+	if s.zoneLoad != nil {
+		atomic.AddUint64(&s.zoneLoad.totalConns, 1)
+	}
+}
+
+// release uncounts the in-flight request acquired on the server.
+func (p *pool) release(s *server) {
+	atomic.AddUint64(&s.currConns, ^uint64(0))
+	atomic.AddUint64(&p.totalConns, ^uint64(0))
+	if s.zoneLoad != nil {
+		atomic.AddUint64(&s.zoneLoad.totalConns, ^uint64(0))
+	}
+}
@@ -0,0 +1,163 @@
+package grpclb
+
+import (
+	"container/heap"
+	"math"
+)
+
+type rendezvousNode struct {
+	s      *server
+	hash   uint64
+	weight float64
+}
+
+// rendezvous picks the server with the highest score -weight/ln(u), u is the uniform
+// hash of the key and the server in (0, 1), see "Weighted Distributed Hash Tables"
+// by Schindelhauer and Schomaker.
+type rendezvous struct {
+	*pool
+	nodes []rendezvousNode
+}
+
+func newRendezvous(p *pool) selector {
+	return &rendezvous{pool: p}
+}
+
+func (r *rendezvous) add(s *server) {
+	if r.register(s) && s.weight > 0 {
+		r.insert(s)
+	}
+}
+
+// insert the server of zero weight is not inserted, so it is never picked.
+func (r *rendezvous) insert(s *server) {
+	var hash uint64
+	if rh, ok := r.opts.ringHasher.(RingHasher64); ok {
+		hash = rh.Sum64([]byte(s.addr.Addr))
+	} else {
+		hash = uint64(r.opts.ringHasher.Sum32([]byte(s.addr.Addr)))
+	}
+	r.nodes = append(r.nodes, rendezvousNode{
+		s:      s,
+		hash:   mix64(hash),
+		weight: float64(s.weight),
+	})
+}
+
+func (r *rendezvous) delete(addr string) {
+	if s, ok := r.unregister(addr); ok {
+		r.remove(s)
+	}
+}
+
+func (r *rendezvous) remove(s *server) {
+	for i, n := range r.nodes {
+		if n.s == s {
+			r.nodes = append(r.nodes[:i], r.nodes[i+1:]...)
+			return
+		}
+	}
+}
+
+func (r *rendezvous) update(s *server, w WeightLvl) {
+	old := s.weight
+	r.setWeight(s, w)
+	switch {
+	case old <= 0 && w > 0:
+		r.insert(s)
+	case w <= 0:
+		r.remove(s)
+	default:
+		for i := range r.nodes {
+			if r.nodes[i].s == s {
+				r.nodes[i].weight = float64(w)
+			}
+		}
+	}
+}
+
+// walk the owner is found in one pass without allocation, the others are
+// popped from a heap only when they are needed, so the top-k servers cost O(n + k·log n).
+func (r *rendezvous) walk(h Hasher, fn func(s *server) bool) {
+	n := len(r.nodes)
+	if n == 0 {
+		return
+	}
+	key := ringKey(h)
+
+	best, bestScore := 0, r.score(key, &r.nodes[0])
+	for i := 1; i < n; i++ {
+		if score := r.score(key, &r.nodes[i]); r.higher(score, &r.nodes[i], bestScore, &r.nodes[best]) {
+			best, bestScore = i, score
+		}
+	}
+	if !fn(r.nodes[best].s) || n == 1 {
+		return
+	}
+
+	rh := &rendezvousHeap{r: r, items: make([]scoredNode, 0, n-1)}
+	for i := range r.nodes {
+		if i != best {
+			rh.items = append(rh.items, scoredNode{node: &r.nodes[i], score: r.score(key, &r.nodes[i])})
+		}
+	}
+	heap.Init(rh)
+	for rh.Len() > 0 {
+		if !fn(heap.Pop(rh).(scoredNode).node.s) {
+			return
+		}
+	}
+}
+
+func (r *rendezvous) snapshot(p *pool) selector {
+	return &rendezvous{pool: p, nodes: append([]rendezvousNode(nil), r.nodes...)}
+}
+
+func (r *rendezvous) score(key uint64, n *rendezvousNode) float64 {
+	// u in (0, 1) with 53-bit precision.
+	u := (float64(mix64(key^n.hash)>>11) + 0.5) / (1 << 53)
+	return -n.weight / math.Log(u)
+}
+
+// higher the ties are broken by the address.
+func (r *rendezvous) higher(s1 float64, n1 *rendezvousNode, s2 float64, n2 *rendezvousNode) bool {
+	if s1 != s2 {
+		return s1 > s2
+	}
+	return n1.s.addr.Addr < n2.s.addr.Addr
+}
+
+type scoredNode struct {
+	node  *rendezvousNode
+	score float64
+}
+
+// rendezvousHeap the max heap of the scores.
+type rendezvousHeap struct {
+	r     *rendezvous
+	items []scoredNode
+}
+
+func (h *rendezvousHeap) Len() int { return len(h.items) }
+
+func (h *rendezvousHeap) Less(i, j int) bool {
+	return h.r.higher(h.items[i].score, h.items[i].node, h.items[j].score, h.items[j].node)
+}
+
+func (h *rendezvousHeap) Swap(i, j int) { h.items[i], h.items[j] = h.items[j], h.items[i] }
+
+func (h *rendezvousHeap) Push(x interface{}) { h.items = append(h.items, x.(scoredNode)) }
+
+func (h *rendezvousHeap) Pop() interface{} {
+	n := len(h.items)
+	x := h.items[n-1]
+	h.items = h.items[:n-1]
+	return x
+}
+
+// mix64 the finalizer of splitmix64.
+func mix64(z uint64) uint64 {
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
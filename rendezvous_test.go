@@ -0,0 +1,63 @@
+package grpclb
+
+import (
+	"sort"
+	"strconv"
+	"testing"
+)
+
+func Test_rendezvous_walk(t *testing.T) {
+	r := newTestSelector(newRendezvous, newPool(newOptions()), Level1, Level2, Level3, Level1, Level5).(*rendezvous)
+	for i := 0; i < 100; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		var walked []*rendezvousNode
+		r.walk(h, func(s *server) bool {
+			for j := range r.nodes {
+				if r.nodes[j].s == s {
+					walked = append(walked, &r.nodes[j])
+				}
+			}
+			return true
+		})
+		if len(walked) != len(r.nodes) {
+			t.Fatalf("rendezvous.walk() walked %v servers, want %v", len(walked), len(r.nodes))
+		}
+		key := ringKey(h)
+		if !sort.SliceIsSorted(walked, func(a, b int) bool {
+			return r.higher(r.score(key, walked[a]), walked[a], r.score(key, walked[b]), walked[b])
+		}) {
+			t.Errorf("rendezvous.walk() is not in the order of scores")
+		}
+	}
+}
+
+func Test_rendezvous_weight(t *testing.T) {
+	r := newTestSelector(newRendezvous, newPool(newOptions()), Level1, Level3).(*rendezvous)
+	counts := map[string]int{}
+	for i := 0; i < 40000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _ := lookup(r, h)
+		counts[s.addr.Addr]++
+	}
+	if ratio := float64(counts["127.0.0.1:8081"]) / float64(counts["127.0.0.1:8080"]); ratio < 2.7 || ratio > 3.3 {
+		t.Errorf("rendezvous picked the servers in ratio %v, want 3", ratio)
+	}
+}
+
+func Test_rendezvous_delete(t *testing.T) {
+	r := newTestSelector(newRendezvous, newPool(newOptions()), Level1, Level1, Level1).(*rendezvous)
+	owners := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _ := lookup(r, h)
+		owners[i] = s.addr.Addr
+	}
+	r.delete("127.0.0.1:8081")
+	for i, owner := range owners {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _ := lookup(r, h)
+		if owner != "127.0.0.1:8081" && s.addr.Addr != owner {
+			t.Fatalf("rendezvous.delete() moved key %v from %v to %v", i, owner, s.addr.Addr)
+		}
+	}
+}
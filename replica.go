@@ -0,0 +1,71 @@
+package grpclb
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/resolver"
+)
+
+// Replicator the balancer builder lists the replicas of a key, the builders returned by
+// NewKetamaBuilder and the others in this package implement it, so are the registered
+// ones got by balancer.Get.
+type Replicator interface {
+	// Successors returns at most n distinct servers in the preference order of the key on
+	// the ClientConn dialed to the endpoint, the first one is the owner.
+	Successors(endpoint string, key Hasher, n int) []resolver.Address
+}
+
+type replicaKey struct{}
+
+// ReplicaToContext set the k-th replica of the HashKey as the target of the RPC,
+// 0 is the owner, 1 is the first successor and so on, it is used to read from
+// the other replicas on failover.
+func ReplicaToContext(ctx context.Context, k int) context.Context {
+	return context.WithValue(ctx, replicaKey{}, k)
+}
+
+// replicaFromContext the k-th replica set by ReplicaToContext, the k is wrapped by the
+// number of servers walked by the selector, which excludes the servers of zero weight.
+func replicaFromContext(ctx context.Context, sel selector, h Hasher) int {
+	k, _ := ctx.Value(replicaKey{}).(int)
+	if k <= 0 {
+		return 0
+	}
+	var n int
+	sel.walk(h, func(s *server) bool {
+		n++
+		return true
+	})
+	if n == 0 {
+		return 0
+	}
+	return k % n
+}
+
+// replicas returns at most n distinct servers in the preference order of the key.
+func replicas(sel selector, h Hasher, n int) []*server {
+	var ss []*server
+	if n <= 0 {
+		return ss
+	}
+	sel.walk(h, func(s *server) bool {
+		ss = append(ss, s)
+		return len(ss) < n
+	})
+	return ss
+}
+
+// skipReplicas returns an accept func for search, which skips the first k servers,
+// so the k-th replica is the first one accepted.
+func skipReplicas(k int, accept func(s *server) bool) func(s *server) bool {
+	if k == 0 {
+		return accept
+	}
+	var skipped int
+	return func(s *server) bool {
+		if skipped < k {
+			skipped++
+			return false
+		}
+		return accept(s)
+	}
+}
@@ -0,0 +1,44 @@
+package grpclb
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/resolver"
+)
+
+func TestReplicaToContext(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081", "127.0.0.1:8082")
+	ctx := StrOrNumToContext(context.Background(), "key")
+	h, _ := strOrNumFromContext(ctx)
+	successors := replicas(k, h, 3)
+
+	for i := 0; i < 4; i++ {
+		r := replicaFromContext(ReplicaToContext(ctx, i), k, h)
+		s, _, err := search(k, h, skipReplicas(r, acceptAll))
+		if err != nil {
+			t.Fatalf("search() error = %v", err)
+		}
+		if want := successors[i%3]; s != want {
+			t.Errorf("search() replica %v = %v, want %v", i, s.addr.Addr, want.addr.Addr)
+		}
+	}
+}
+
+func TestReplicaToContext_zeroWeight(t *testing.T) {
+	k := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081")
+	k.add(newServer(resolver.Address{Addr: "127.0.0.1:8082", Metadata: WeightLvl(0)}))
+	ctx := StrOrNumToContext(context.Background(), "key")
+	h, _ := strOrNumFromContext(ctx)
+	successors := replicas(k, h, 2)
+
+	// the server of zero weight is not walked, so the replicas wrap by the other two.
+	r := replicaFromContext(ReplicaToContext(ctx, 2), k, h)
+	s, _, err := search(k, h, skipReplicas(r, acceptAll))
+	if err != nil {
+		t.Fatalf("search() error = %v", err)
+	}
+	if s != successors[0] {
+		t.Errorf("search() replica 2 = %v, want %v", s.addr.Addr, successors[0].addr.Addr)
+	}
+}
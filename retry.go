@@ -0,0 +1,61 @@
+package grpclb
+
+import (
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// DefaultMaxRetries the default retry budget of a call.
+const DefaultMaxRetries = 2
+
+// RetryOption configures the failover interceptor.
+type RetryOption func(*retryOptions)
+
+type retryOptions struct {
+	maxRetries int
+	codes      map[codes.Code]bool
+}
+
+// WithMaxRetries retry a call at most n times, each retry goes to the next replica.
+func WithMaxRetries(n int) RetryOption {
+	return func(o *retryOptions) {
+		o.maxRetries = n
+	}
+}
+
+// WithRetryCodes retry the calls failed with the codes, the default is codes.Unavailable.
+func WithRetryCodes(cs ...codes.Code) RetryOption {
+	return func(o *retryOptions) {
+		o.codes = make(map[codes.Code]bool, len(cs))
+		for _, c := range cs {
+			o.codes[c] = true
+		}
+	}
+}
+
+// UnaryClientInterceptor fails over to the next distinct server of the HashKey when
+// the call fails with a retryable code, it works with the balancers of this package
+// by ReplicaToContext, so the retries go to the successors of the owner.
+func UnaryClientInterceptor(opts ...RetryOption) grpc.UnaryClientInterceptor {
+	o := &retryOptions{
+		maxRetries: DefaultMaxRetries,
+		codes:      map[codes.Code]bool{codes.Unavailable: true},
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		base, _ := ctx.Value(replicaKey{}).(int)
+		err := invoker(ctx, method, req, reply, cc, callOpts...)
+		for attempt := 1; attempt <= o.maxRetries && err != nil; attempt++ {
+			if !o.codes[status.Code(err)] || ctx.Err() != nil {
+				return err
+			}
+			err = invoker(ReplicaToContext(ctx, base+attempt), method, req, reply, cc, callOpts...)
+		}
+		return err
+	}
+}
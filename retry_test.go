@@ -0,0 +1,51 @@
+package grpclb
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestUnaryClientInterceptor(t *testing.T) {
+	unavailable := status.Error(codes.Unavailable, "unavailable")
+	tests := []struct {
+		name     string
+		opts     []RetryOption
+		errs     []error
+		wantErr  error
+		replicas []int
+	}{
+		{"success", nil, []error{nil}, nil, []int{0}},
+		{"failover", nil, []error{unavailable, nil}, nil, []int{0, 1}},
+		{"budget exhausted", nil, []error{unavailable, unavailable, unavailable, nil}, unavailable, []int{0, 1, 2}},
+		{"larger budget", []RetryOption{WithMaxRetries(3)}, []error{unavailable, unavailable, unavailable, nil}, nil, []int{0, 1, 2, 3}},
+		{"not retryable", nil, []error{errors.New("internal")}, errors.New("internal"), []int{0}},
+		{"retry codes", []RetryOption{WithRetryCodes(codes.ResourceExhausted)}, []error{unavailable}, unavailable, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var replicas []int
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				k, _ := ctx.Value(replicaKey{}).(int)
+				replicas = append(replicas, k)
+				return tt.errs[len(replicas)-1]
+			}
+			err := UnaryClientInterceptor(tt.opts...)(context.Background(), "/test", nil, nil, nil, invoker)
+			if (err == nil) != (tt.wantErr == nil) || err != nil && err.Error() != tt.wantErr.Error() {
+				t.Errorf("UnaryClientInterceptor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(replicas) != len(tt.replicas) {
+				t.Fatalf("UnaryClientInterceptor() called replicas %v, want %v", replicas, tt.replicas)
+			}
+			for i := range replicas {
+				if replicas[i] != tt.replicas[i] {
+					t.Errorf("UnaryClientInterceptor() called replicas %v, want %v", replicas, tt.replicas)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,86 @@
+package grpclb
+
+import (
+	"crypto/md5"
+	"hash/fnv"
+
+	"github.com/cespare/xxhash"
+	"github.com/spaolacci/murmur3"
+)
+
+// RingHasher hash the servers and their virtual nodes onto the ring,
+// the HashKey set by StrOrNumToContext is hashed by it too.
+type RingHasher interface {
+	// Sum32 uint32 hash of data
+	Sum32(data []byte) uint32
+}
+
+// RingHasher64 the RingHasher with 64-bit hash, the ring places the points in
+// 64-bit hash space when the RingHasher implements it, otherwise the 32-bit
+// hashes are placed at the high 32 bits.
+type RingHasher64 interface {
+	RingHasher
+	// Sum64 uint64 hash of data
+	Sum64(data []byte) uint64
+}
+
+var (
+	// FNV32a RingHasher with 32-bit FNV-1a algorithm.
+	FNV32a RingHasher = fnv32a{}
+	// FNV64a RingHasher64 with 64-bit FNV-1a algorithm.
+	FNV64a RingHasher = fnv64a{}
+	// XXHash RingHasher64 with 64-bit xxHash, Sum32 is the low 32 bits.
+	XXHash RingHasher = xxHash{}
+	// Murmur3 RingHasher64 with murmur3 algorithm, Sum64 is the first half of the 128-bit hash.
+	Murmur3 RingHasher = murmur3Hash{}
+	// MD5Ketama RingHasher with the first 4 bytes of MD5 digest in little endian,
+	// which is the same as the key hash of libketama, so it stays in 32-bit hash space.
+	MD5Ketama RingHasher = md5Ketama{}
+)
+
+type fnv32a struct{}
+
+func (fnv32a) Sum32(data []byte) uint32 {
+	h := fnv.New32a()
+	h.Write(data)
+	return h.Sum32()
+}
+
+type fnv64a struct{}
+
+func (fnv64a) Sum32(data []byte) uint32 {
+	return uint32(fnv64a{}.Sum64(data))
+}
+
+func (fnv64a) Sum64(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+type xxHash struct{}
+
+func (xxHash) Sum32(data []byte) uint32 {
+	return uint32(xxhash.Sum64(data))
+}
+
+func (xxHash) Sum64(data []byte) uint64 {
+	return xxhash.Sum64(data)
+}
+
+type murmur3Hash struct{}
+
+func (murmur3Hash) Sum32(data []byte) uint32 {
+	return murmur3.Sum32(data)
+}
+
+func (murmur3Hash) Sum64(data []byte) uint64 {
+	return murmur3.Sum64(data)
+}
+
+type md5Ketama struct{}
+
+func (md5Ketama) Sum32(data []byte) uint32 {
+	d := md5.Sum(data)
+	return uint32(d[3])<<24 | uint32(d[2])<<16 | uint32(d[1])<<8 | uint32(d[0])
+}
@@ -0,0 +1,41 @@
+package grpclb
+
+import (
+	"testing"
+
+	"golang.org/x/net/context"
+)
+
+func TestRingHasher_Sum32(t *testing.T) {
+	tests := []struct {
+		name string
+		rh   RingHasher
+		data string
+		want uint32
+	}{
+		{"fnv32a", FNV32a, "key", 1746258028},
+		{"xxhash", XXHash, "key", 769737524},
+		{"murmur3", Murmur3, "key", 3801901636},
+		{"md5 ketama", MD5Ketama, "key", 2316004924},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.rh.Sum32([]byte(tt.data)); got != tt.want {
+				t.Errorf("RingHasher.Sum32() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_strOrNumFromContextWith(t *testing.T) {
+	ctx := StrOrNumToContext(context.Background(), "key")
+	for _, rh := range []RingHasher{FNV32a, XXHash, Murmur3, MD5Ketama} {
+		h, ok := newOptions(WithRingHasher(rh)).f(ctx)
+		if !ok {
+			t.Fatalf("options.f() ok = %v, want true", ok)
+		}
+		if got, want := h.Hash32(), rh.Sum32([]byte("key")); got != want {
+			t.Errorf("options.f().Hash32() = %v, want %v", got, want)
+		}
+	}
+}
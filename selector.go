@@ -0,0 +1,63 @@
+package grpclb
+
+// selector places the servers of the pool by a hashing algorithm.
+type selector interface {
+	add(s *server)
+	delete(addr string)
+	// update changes the weight of the server in place, so only the delta of its keys moves.
+	update(s *server, w WeightLvl)
+	// walk calls fn on the distinct servers in the preference order of the hash key,
+	// until fn returns false.
+	walk(h Hasher, fn func(s *server) bool)
+	// underLoad returns an accept func for search which bounds the loads of the servers
+	// by c × average, the pool of the selector implements it.
+	underLoad(c float64) func(s *server) bool
+	// snapshot returns a read-only copy of the selector on p, the snapshot of the pool,
+	// it is taken after the rebuild of a batch and never changed by the later updates.
+	snapshot(p *pool) selector
+}
+
+// rebuilder the selector rebuilds its lookup structure after a batch of updates.
+// rebuild snapshots the servers under the lock of the balancer and returns the work
+// to build, which can be run off the lock.
+type rebuilder interface {
+	rebuild() (build func())
+}
+
+// newSelector new a selector on the pool.
+type newSelector func(p *pool) selector
+
+// lookup returns the most preferred server of the hash key.
+func lookup(sel selector, h Hasher) (*server, error) {
+	var owner *server
+	sel.walk(h, func(s *server) bool {
+		owner = s
+		return false
+	})
+	if owner == nil {
+		return nil, ErrNoServer
+	}
+	return owner, nil
+}
+
+// acceptAll accepts all servers.
+func acceptAll(s *server) bool {
+	return true
+}
+
+// search returns the first server accepted in the preference order of the hash key,
+// and the number of the servers skipped before it.
+func search(sel selector, h Hasher, accept func(s *server) bool) (picked *server, hops int, err error) {
+	sel.walk(h, func(s *server) bool {
+		if accept(s) {
+			picked = s
+			return false
+		}
+		hops++
+		return true
+	})
+	if picked == nil {
+		return nil, hops, ErrNoServer
+	}
+	return picked, hops, nil
+}
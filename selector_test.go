@@ -0,0 +1,70 @@
+package grpclb
+
+import (
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// newTestSelector new a selector on p with the servers of the weights, their ports are
+// from 8080 in order.
+func newTestSelector(newSel newSelector, p *pool, weights ...WeightLvl) selector {
+	sel := newSel(p)
+	for i, w := range weights {
+		sel.add(newServer(resolver.Address{Addr: "127.0.0.1:" + strconv.Itoa(8080+i), Metadata: float64(w)}))
+	}
+	if r, ok := sel.(rebuilder); ok {
+		r.rebuild()()
+	}
+	return sel
+}
+
+func Test_selector_zeroWeight(t *testing.T) {
+	tests := []struct {
+		name   string
+		newSel newSelector
+	}{
+		{"ketama", newKetama},
+		{"jump hash", newJumpHash},
+		{"rendezvous", newRendezvous},
+		{"maglev", newMaglev},
+		{"multi-probe", newMultiProbe},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sel := tt.newSel(newPool(newOptions()))
+			rebuild := func() {
+				if r, ok := sel.(rebuilder); ok {
+					r.rebuild()()
+				}
+			}
+			sel.add(newServer(resolver.Address{Addr: "127.0.0.1:8080", Metadata: Level1}))
+			zero := newServer(resolver.Address{Addr: "127.0.0.1:8081", Metadata: WeightLvl(0)})
+			sel.add(zero)
+			rebuild()
+			for i := 0; i < 100; i++ {
+				h, _ := newStrOrNum(strconv.Itoa(i))
+				sel.walk(h, func(s *server) bool {
+					if s.addr.Addr == "127.0.0.1:8081" {
+						t.Fatalf("walk() visited the server of zero weight")
+					}
+					return true
+				})
+			}
+
+			// the server of zero weight takes the keys after its weight is updated.
+			sel.update(zero, Level1)
+			rebuild()
+			var visited int
+			h, _ := newStrOrNum("key")
+			sel.walk(h, func(s *server) bool {
+				visited++
+				return true
+			})
+			if visited != 2 {
+				t.Errorf("walk() visited %v servers after update, want 2", visited)
+			}
+		})
+	}
+}
@@ -0,0 +1,28 @@
+package grpclb
+
+import "time"
+
+// slowStartMinFraction the share of the keys a server takes at the beginning of its slow start.
+const slowStartMinFraction = 0.1
+
+// slowStart wraps accept to reject a part of the keys of the servers in slow start,
+// the part shrinks linearly over the window, so a new server takes its full share of
+// the keys gradually. The keys are accepted by their hash, so a key accepted once
+// stays on the server for the rest of the window.
+func (p *pool) slowStart(h Hasher, accept func(s *server) bool) func(s *server) bool {
+	window := p.opts.slowStart
+	if window <= 0 {
+		return accept
+	}
+	now := time.Now()
+	u := float64(mix64(ringKey(h))>>11) / (1 << 53)
+	return func(s *server) bool {
+		if !s.started.IsZero() {
+			if elapsed := now.Sub(s.started); elapsed < window &&
+				u >= slowStartMinFraction+(1-slowStartMinFraction)*float64(elapsed)/float64(window) {
+				return false
+			}
+		}
+		return accept(s)
+	}
+}
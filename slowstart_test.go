@@ -0,0 +1,43 @@
+package grpclb
+
+import (
+	"math"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func Test_pool_slowStart(t *testing.T) {
+	tests := []struct {
+		name    string
+		window  time.Duration
+		elapsed time.Duration
+		started bool
+		want    float64
+	}{
+		{"disabled", 0, 0, true, 1},
+		{"not slow started", time.Hour, 0, false, 1},
+		{"begin", time.Hour, 0, true, slowStartMinFraction},
+		{"half", time.Hour, 30 * time.Minute, true, (1 + slowStartMinFraction) / 2},
+		{"end", time.Hour, time.Hour, true, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPool(newOptions(WithSlowStart(tt.window)))
+			s := &server{}
+			if tt.started {
+				s.started = time.Now().Add(-tt.elapsed)
+			}
+			var accepted int
+			for i := 0; i < 10000; i++ {
+				h, _ := newStrOrNum(strconv.Itoa(i))
+				if p.slowStart(h, acceptAll)(s) {
+					accepted++
+				}
+			}
+			if got := float64(accepted) / 10000; math.Abs(got-tt.want) > 0.02 {
+				t.Errorf("pool.slowStart() accepted %v of the keys, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package grpclb
+
+import "sort"
+
+// zoneSelector places the servers of each zone on its own selector, and walks the
+// servers of the local zone first, so the RPCs spill to the other zones only when
+// no server of the local zone is accepted, and the keys stick to their servers
+// within each zone.
+type zoneSelector struct {
+	*pool
+	newSel newSelector
+	zones  map[string]*zone
+	names  []string // sorted.
+}
+
+type zone struct {
+	p   *pool
+	sel selector
+}
+
+// zoned wraps newSel by the zones of the servers.
+func zoned(newSel newSelector) newSelector {
+	return func(p *pool) selector {
+		return &zoneSelector{pool: p, newSel: newSel, zones: map[string]*zone{}}
+	}
+}
+
+func (zs *zoneSelector) add(s *server) {
+	if !zs.register(s) {
+		return
+	}
+	name := s.meta.Zone
+	z, ok := zs.zones[name]
+	if !ok {
+		p := &pool{counters: zs.counters.zone(name), servers: map[string]*server{}, opts: zs.opts}
+		z = &zone{p: p, sel: zs.newSel(p)}
+		zs.zones[name] = z
+		zs.names = append(zs.names, name)
+		sort.Strings(zs.names)
+	}
+	s.zoneLoad = z.p.counters
+	z.sel.add(s)
+}
+
+func (zs *zoneSelector) delete(addr string) {
+	s, ok := zs.unregister(addr)
+	if !ok {
+		return
+	}
+	name := s.meta.Zone
+	z := zs.zones[name]
+	z.sel.delete(addr)
+	if len(z.p.servers) > 0 {
+		return
+	}
+	delete(zs.zones, name)
+	for i, v := range zs.names {
+		if v == name {
+			zs.names = append(zs.names[:i], zs.names[i+1:]...)
+			break
+		}
+	}
+}
+
+func (zs *zoneSelector) update(s *server, w WeightLvl) {
+	if z, ok := zs.zones[s.meta.Zone]; ok {
+		z.sel.update(s, w)
+	}
+	zs.setWeight(s, w)
+}
+
+// rezone moves the server to the zone by a new server, so the in-flight requests of
+// the old one are still released to the loads of its old zone. It returns the new one.
+func (zs *zoneSelector) rezone(s *server, name string) *server {
+	zs.delete(s.addr.Addr)
+	ns := renewServer(s, s.started)
+	ns.meta.Zone = name
+	zs.add(ns)
+	return ns
+}
+
+// walk the servers of the local zone, then the other zones in the order of the names.
+func (zs *zoneSelector) walk(h Hasher, fn func(s *server) bool) {
+	next := true
+	visit := func(s *server) bool {
+		next = fn(s)
+		return next
+	}
+	if z, ok := zs.zones[zs.opts.zone]; ok {
+		if z.sel.walk(h, visit); !next {
+			return
+		}
+	}
+	for _, name := range zs.names {
+		if name == zs.opts.zone {
+			continue
+		}
+		if zs.zones[name].sel.walk(h, visit); !next {
+			return
+		}
+	}
+}
+
+// underLoad bounds the loads of the servers by the average of their zone, so the servers
+// of the local zone are not capped by the idle servers of the other zones.
+func (zs *zoneSelector) underLoad(c float64) func(s *server) bool {
+	accepts := make(map[*counters]func(s *server) bool, len(zs.zones))
+	return func(s *server) bool {
+		accept, ok := accepts[s.zoneLoad]
+		if !ok {
+			accept = zs.pool.underLoad(c)
+			for _, z := range zs.zones {
+				if z.p.counters == s.zoneLoad {
+					accept = z.p.underLoad(c)
+					break
+				}
+			}
+			accepts[s.zoneLoad] = accept
+		}
+		return accept(s)
+	}
+}
+
+func (zs *zoneSelector) rebuild() func() {
+	var builds []func()
+	for _, z := range zs.zones {
+		if r, ok := z.sel.(rebuilder); ok {
+			builds = append(builds, r.rebuild())
+		}
+	}
+	return func() {
+		for _, build := range builds {
+			build()
+		}
+	}
+}
+
+func (zs *zoneSelector) snapshot(p *pool) selector {
+	zones := make(map[string]*zone, len(zs.zones))
+	for name, z := range zs.zones {
+		zp := z.p.snapshot()
+		zones[name] = &zone{p: zp, sel: z.sel.snapshot(zp)}
+	}
+	return &zoneSelector{pool: p, newSel: zs.newSel, zones: zones, names: append([]string(nil), zs.names...)}
+}
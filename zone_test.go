@@ -0,0 +1,84 @@
+package grpclb
+
+import (
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc/resolver"
+)
+
+func newTestZoneSelector(zone string) *zoneSelector {
+	zs := zoned(newKetama)(newPool(newOptions(WithZone(zone)))).(*zoneSelector)
+	for i, z := range []string{"az1", "az1", "az2", "az2"} {
+		s := newServer(resolver.Address{Addr: "127.0.0.1:" + strconv.Itoa(8080+i), Metadata: ServerMeta{Zone: z}})
+		s.connected.Set()
+		zs.add(s)
+	}
+	zs.rebuild()()
+	return zs
+}
+
+func Test_zoneSelector_walk(t *testing.T) {
+	zs := newTestZoneSelector("az1")
+	az1, az2 := newTestKetama("127.0.0.1:8080", "127.0.0.1:8081"), newTestKetama("127.0.0.1:8082", "127.0.0.1:8083")
+	connected := func(s *server) bool {
+		return s.connected.IsSet()
+	}
+	for i := 0; i < 100; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		owner, _ := lookup(az1, h)
+		if s, _, _ := search(zs, h, connected); s.addr.Addr != owner.addr.Addr {
+			t.Fatalf("search(%d) = %v, want %v of the local zone", i, s.addr.Addr, owner.addr.Addr)
+		}
+	}
+
+	// spill to the other zone when the local zone is unavailable.
+	for _, s := range zs.list {
+		if s.meta.Zone == "az1" {
+			s.connected.UnSet()
+		}
+	}
+	for i := 0; i < 100; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		owner, _ := lookup(az2, h)
+		if s, _, _ := search(zs, h, connected); s.addr.Addr != owner.addr.Addr {
+			t.Fatalf("search(%d) = %v, want %v of the other zone", i, s.addr.Addr, owner.addr.Addr)
+		}
+	}
+}
+
+func Test_zoneSelector_delete(t *testing.T) {
+	zs := newTestZoneSelector("az1")
+	zs.delete("127.0.0.1:8080")
+	zs.delete("127.0.0.1:8081")
+	if _, ok := zs.zones["az1"]; ok || len(zs.names) != 1 {
+		t.Errorf("zoneSelector.delete() zones = %v, want [az2]", zs.names)
+	}
+	zs.rebuild()()
+	h, _ := newStrOrNum("key")
+	if s, err := lookup(zs, h); err != nil || s.meta.Zone != "az2" {
+		t.Errorf("lookup() = %v, %v, want a server of az2", s, err)
+	}
+}
+
+func Test_zoneSelector_underLoad(t *testing.T) {
+	zs := newTestZoneSelector("az1")
+	available := func(s *server) bool {
+		return s.connected.IsSet() && zs.underLoad(1.25)(s)
+	}
+	var spilled int
+	for i := 0; i < 1000; i++ {
+		h, _ := newStrOrNum(strconv.Itoa(i))
+		s, _, err := search(zs, h, available)
+		if err != nil {
+			t.Fatalf("search() error = %v", err)
+		}
+		if s.meta.Zone != "az1" {
+			spilled++
+		}
+		zs.acquire(s)
+	}
+	if spilled > 0 {
+		t.Errorf("search() spilled %v of the in-flight picks to the other zone", spilled)
+	}
+}